@@ -0,0 +1,265 @@
+// Package agent is the protocol between the lounge app and the agent running
+// on each lounge PC, and the agent side of it.
+//
+// The lounge dials the agent over TCP (optionally TLS) and both sides send
+// one JSON Message per line. The lounge opens with a hello carrying the shared
+// token, then sends lock, unlock and shutdown commands and a ping now and
+// then. The agent answers every message with a status, or an error.
+package agent
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+const DefaultPort = 7070
+
+// Message types.
+const (
+	MsgHello    = "hello"    // lounge -> agent: Token, DeviceID
+	MsgLock     = "lock"     // lounge -> agent
+	MsgUnlock   = "unlock"   // lounge -> agent: UserID, UserName
+	MsgPing     = "ping"     // lounge -> agent
+	MsgShutdown = "shutdown" // lounge -> agent
+	MsgStatus   = "status"   // agent -> lounge: Locked, Activity
+	MsgError    = "error"    // agent -> lounge: Error
+)
+
+// HelloTimeout is how long the agent waits for the hello before hanging up.
+const HelloTimeout = 10 * time.Second
+
+// CallTimeout is how long the lounge waits for a reply. An agent must answer
+// within it, including the command it runs and the activity it reports.
+const CallTimeout = 10 * time.Second
+
+// maxLine bounds one message so a bad peer cannot exhaust memory.
+const maxLine = 64 << 10
+
+type Message struct {
+	Type     string `json:"type"`
+	Token    string `json:"token,omitempty"`
+	DeviceID int    `json:"device_id,omitempty"`
+	UserID   string `json:"user_id,omitempty"`
+	UserName string `json:"user_name,omitempty"`
+	Locked   bool   `json:"locked"`
+	Error    string `json:"error,omitempty"`
+	// Activity is filled in by agents that can see who is using the PC.
+	Activity *Activity `json:"activity,omitempty"`
+}
+
+// Activity is what the agent sees on the PC: the signed-in OS user, how long
+// since the last keyboard or mouse input, and the game in the foreground.
+type Activity struct {
+	User        string `json:"user,omitempty"`
+	IdleSeconds int    `json:"idle_seconds"`
+	Game        string `json:"game,omitempty"`
+}
+
+// Conn reads and writes Messages on a network connection.
+type Conn struct {
+	net.Conn
+	sc *bufio.Scanner
+}
+
+func NewConn(c net.Conn) *Conn {
+	sc := bufio.NewScanner(c)
+	sc.Buffer(make([]byte, 0, 4096), maxLine)
+	return &Conn{Conn: c, sc: sc}
+}
+
+func (c *Conn) Send(m Message) error {
+	b, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	_, err = c.Write(append(b, '\n'))
+	return err
+}
+
+func (c *Conn) Receive() (Message, error) {
+	var m Message
+	if !c.sc.Scan() {
+		if err := c.sc.Err(); err != nil {
+			return m, err
+		}
+		return m, errors.New("agent: connection closed")
+	}
+	if err := json.Unmarshal(c.sc.Bytes(), &m); err != nil {
+		return m, fmt.Errorf("agent: bad message: %w", err)
+	}
+	return m, nil
+}
+
+// Call sends m and waits for the reply, turning an error reply into an error.
+func (c *Conn) Call(m Message, timeout time.Duration) (Message, error) {
+	if err := c.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return Message{}, err
+	}
+	defer c.SetDeadline(time.Time{})
+	if err := c.Send(m); err != nil {
+		return Message{}, err
+	}
+	reply, err := c.Receive()
+	if err != nil {
+		return reply, err
+	}
+	if reply.Type == MsgError {
+		return reply, errors.New(reply.Error)
+	}
+	return reply, nil
+}
+
+// ---------- Agent side ----------
+
+// Handler does the actual locking on the PC.
+type Handler interface {
+	Lock() error
+	Unlock(userID, userName string) error
+}
+
+// ShutdownHandler is implemented by handlers that can power the PC off.
+type ShutdownHandler interface {
+	Shutdown() error
+}
+
+// Reporter is implemented by handlers that can report Activity; it is sent
+// with every status, so the lounge's pings double as heartbeats. A nil
+// Activity means there is nothing to report.
+type Reporter interface {
+	Activity() (*Activity, error)
+}
+
+// Server answers lounge connections. It also serves as an in-process agent
+// stand-in: give it a Handler that records calls and hand it one end of a
+// net.Pipe.
+type Server struct {
+	Token    string
+	DeviceID int
+	Handler  Handler
+	// Logf reports connections and commands; nil discards them.
+	Logf func(format string, args ...any)
+
+	mu     sync.Mutex
+	locked bool
+}
+
+// NewServer returns a server that reports the PC as locked until told
+// otherwise; call SetLocked if it starts in another state.
+func NewServer(token string, deviceID int, h Handler) *Server {
+	return &Server{Token: token, DeviceID: deviceID, Handler: h, locked: true}
+}
+
+func (s *Server) SetLocked(locked bool) {
+	s.mu.Lock()
+	s.locked = locked
+	s.mu.Unlock()
+}
+
+func (s *Server) Locked() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.locked
+}
+
+func (s *Server) logf(format string, args ...any) {
+	if s.Logf != nil {
+		s.Logf(format, args...)
+	}
+}
+
+// Serve accepts connections until l is closed.
+func (s *Server) Serve(l net.Listener) error {
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go s.ServeConn(c)
+	}
+}
+
+// ServeConn handles one lounge connection and closes it when done.
+func (s *Server) ServeConn(nc net.Conn) {
+	defer nc.Close()
+	c := NewConn(nc)
+	_ = c.SetReadDeadline(time.Now().Add(HelloTimeout))
+	hello, err := c.Receive()
+	if err != nil {
+		s.logf("agent: %s: %v", nc.RemoteAddr(), err)
+		return
+	}
+	if hello.Type != MsgHello || subtle.ConstantTimeCompare([]byte(hello.Token), []byte(s.Token)) != 1 {
+		_ = c.Send(Message{Type: MsgError, Error: "bad token"})
+		s.logf("agent: %s: refused, bad hello", nc.RemoteAddr())
+		return
+	}
+	if hello.DeviceID != 0 && s.DeviceID != 0 && hello.DeviceID != s.DeviceID {
+		_ = c.Send(Message{Type: MsgError, Error: fmt.Sprintf("this is device %d, not %d", s.DeviceID, hello.DeviceID)})
+		return
+	}
+	_ = c.SetReadDeadline(time.Time{})
+	s.logf("agent: %s connected", nc.RemoteAddr())
+	if err := c.Send(s.status()); err != nil {
+		return
+	}
+	for {
+		m, err := c.Receive()
+		if err != nil {
+			s.logf("agent: %s: %v", nc.RemoteAddr(), err)
+			return
+		}
+		reply := s.handle(m)
+		if err := c.Send(reply); err != nil {
+			return
+		}
+	}
+}
+
+func (s *Server) status() Message {
+	m := Message{Type: MsgStatus, DeviceID: s.DeviceID, Locked: s.Locked()}
+	if r, ok := s.Handler.(Reporter); ok {
+		a, err := r.Activity()
+		if err != nil {
+			s.logf("agent: activity: %v", err)
+		}
+		m.Activity = a
+	}
+	return m
+}
+
+func (s *Server) handle(m Message) Message {
+	var err error
+	switch m.Type {
+	case MsgPing:
+	case MsgLock:
+		s.logf("agent: lock")
+		if err = s.Handler.Lock(); err == nil {
+			s.SetLocked(true)
+		}
+	case MsgUnlock:
+		s.logf("agent: unlock for %s (%s)", m.UserName, m.UserID)
+		if err = s.Handler.Unlock(m.UserID, m.UserName); err == nil {
+			s.SetLocked(false)
+		}
+	case MsgShutdown:
+		sh, ok := s.Handler.(ShutdownHandler)
+		if !ok {
+			err = errors.New("this agent cannot shut the PC down")
+			break
+		}
+		s.logf("agent: shutdown")
+		err = sh.Shutdown()
+	default:
+		err = fmt.Errorf("unknown message type %q", m.Type)
+	}
+	if err != nil {
+		return Message{Type: MsgError, Error: err.Error(), Locked: s.Locked()}
+	}
+	return s.status()
+}
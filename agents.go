@@ -0,0 +1,424 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"image/color"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"lounge/agent"
+)
+
+// ---------- PC agents ----------
+//
+// Each PC listed under "agents" in log/config.json runs lounge-agent. The
+// lounge keeps a connection to every agent and tells it to unlock while
+// someone is checked in on the PC and to lock once it is free again. On every
+// (re)connect the agent is told the current state, so a PC that was offline
+// catches up.
+
+const (
+	agentCallTimeout = agent.CallTimeout
+	agentPing        = 15 * time.Second
+	agentMinBackoff  = time.Second
+	agentMaxBackoff  = 30 * time.Second
+
+	// agentActiveIdle is the idle time under which a signed-in user counts
+	// as using the PC.
+	agentActiveIdle = 2 * time.Minute
+	// agentDefaultIdle is how long an occupied PC may sit idle before it is
+	// flagged, when idle_minutes is not set.
+	agentDefaultIdle = 30 * time.Minute
+)
+
+type AgentsConfig struct {
+	Token string `json:"token"`
+	// Devices maps a device ID to the agent's host:port.
+	Devices map[string]string `json:"devices"`
+	TLS     bool              `json:"tls"`
+	// CAFile verifies agents with self-signed certificates.
+	CAFile             string `json:"ca_file,omitempty"`
+	InsecureSkipVerify bool   `json:"insecure_skip_verify,omitempty"`
+	// IdleMinutes flags an occupied PC nobody has touched for this long.
+	IdleMinutes int `json:"idle_minutes,omitempty"`
+}
+
+func (c AgentsConfig) idleLimit() time.Duration {
+	if c.IdleMinutes > 0 {
+		return time.Duration(c.IdleMinutes) * time.Minute
+	}
+	return agentDefaultIdle
+}
+
+// AgentStatus is what the lounge last heard from a device's agent.
+type AgentStatus struct {
+	Connected bool
+	Locked    bool
+	Activity  *agent.Activity // nil if the agent reports none
+	Err       string
+	Since     time.Time
+}
+
+// agentWant is the state a PC should be in.
+type agentWant struct {
+	Locked   bool
+	UserID   string
+	UserName string
+}
+
+type agentLink struct {
+	deviceID int
+	addr     string
+
+	mu       sync.Mutex
+	want     agentWant
+	resend   bool
+	shutdown bool
+	changed  chan struct{}
+	stop     chan struct{} // closed by stopAgents
+}
+
+var (
+	agentMu          sync.Mutex
+	agentLinks       = map[int]*agentLink{}
+	agentStatus      = map[int]AgentStatus{}
+	agentsOnce       sync.Once
+	agentUnsubscribe func()
+)
+
+var errAgentStopped = errors.New("agent link stopped")
+
+// agentDial opens the connection to an agent. Tests can swap it for one end
+// of a net.Pipe served by an in-process agent.Server.
+var agentDial = dialAgent
+
+func dialAgent(deviceID int, addr string) (net.Conn, error) {
+	d := &net.Dialer{Timeout: agentCallTimeout}
+	cfg := appConfig.Agents
+	if !cfg.TLS {
+		return d.Dial("tcp", addr)
+	}
+	tc := &tls.Config{MinVersion: tls.VersionTLS12, InsecureSkipVerify: cfg.InsecureSkipVerify}
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read agent CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("%s: no certificates found", cfg.CAFile)
+		}
+		tc.RootCAs = pool
+	}
+	return tls.DialWithDialer(d, "tcp", addr, tc)
+}
+
+// startAgents connects to every configured agent; later calls do nothing.
+// Run it only holding the instance lock, so PCs get commands from one
+// process per data folder.
+func startAgents() {
+	if len(appConfig.Agents.Devices) == 0 {
+		return
+	}
+	agentsOnce.Do(func() {
+		agentMu.Lock()
+		for key, addr := range appConfig.Agents.Devices {
+			id, err := strconv.Atoi(key)
+			if err != nil || addr == "" {
+				fmt.Printf("Error in agents config: device %q: want a device ID and an address\n", key)
+				continue
+			}
+			agentLinks[id] = &agentLink{deviceID: id, addr: addr, want: agentWant{Locked: true}, changed: make(chan struct{}, 1), stop: make(chan struct{})}
+		}
+		links := make([]*agentLink, 0, len(agentLinks))
+		for _, l := range agentLinks {
+			links = append(links, l)
+		}
+		agentMu.Unlock()
+
+		syncAgents()
+		for _, l := range links {
+			go l.run()
+		}
+		unsubscribe := loungeBus.subscribe(func([]LoungeEvent) { syncAgents() },
+			EventCheckIn, EventCheckOut, EventAssign, EventSwitch, EventReload, EventUndo, EventRedo)
+		agentMu.Lock()
+		agentUnsubscribe = unsubscribe
+		agentMu.Unlock()
+	})
+}
+
+// stopAgents closes every link and forgets what the agents reported, so a
+// later startAgents begins afresh. Tests call it between runs.
+func stopAgents() {
+	agentMu.Lock()
+	for _, l := range agentLinks {
+		close(l.stop)
+	}
+	agentLinks = map[int]*agentLink{}
+	agentStatus = map[int]AgentStatus{}
+	unsubscribe := agentUnsubscribe
+	agentUnsubscribe = nil
+	agentsOnce = sync.Once{}
+	agentMu.Unlock()
+	if unsubscribe != nil {
+		unsubscribe()
+	}
+}
+
+// syncAgents works out from the state which PCs should be unlocked and
+// passes any change to their links.
+func syncAgents() {
+	snap := snapshotState()
+	agentMu.Lock()
+	defer agentMu.Unlock()
+	for id, l := range agentLinks {
+		want := agentWant{Locked: true}
+		if us := snap.usersOn(id); len(us) > 0 {
+			want = agentWant{UserID: us[0].ID, UserName: us[0].Name}
+		}
+		l.setWant(want)
+	}
+}
+
+func (l *agentLink) setWant(w agentWant) {
+	l.mu.Lock()
+	changed := l.want != w
+	l.want = w
+	l.mu.Unlock()
+	if changed {
+		select {
+		case l.changed <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// currentWant returns the wanted state and whether it must be sent even if
+// it already was.
+func (l *agentLink) currentWant() (agentWant, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	resend := l.resend
+	l.resend = false
+	return l.want, resend
+}
+
+// shutdownAgent asks a connected agent to power its PC off.
+func shutdownAgent(deviceID int) error {
+	agentMu.Lock()
+	l := agentLinks[deviceID]
+	connected := agentStatus[deviceID].Connected
+	agentMu.Unlock()
+	if l == nil {
+		return fmt.Errorf("device %d has no agent", deviceID)
+	}
+	if !connected {
+		return fmt.Errorf("the agent on device %d is not connected", deviceID)
+	}
+	l.mu.Lock()
+	l.shutdown = true
+	l.mu.Unlock()
+	select {
+	case l.changed <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (l *agentLink) takeShutdown() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	s := l.shutdown
+	l.shutdown = false
+	return s
+}
+
+// reapplyAgent sends a device's wanted state again, for instance to lock a
+// free PC somebody is using anyway.
+func reapplyAgent(deviceID int) {
+	agentMu.Lock()
+	l := agentLinks[deviceID]
+	agentMu.Unlock()
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	l.resend = true
+	l.mu.Unlock()
+	select {
+	case l.changed <- struct{}{}:
+	default:
+	}
+}
+
+// run keeps the link connected until stopAgents.
+func (l *agentLink) run() {
+	backoff := agentMinBackoff
+	for {
+		start := time.Now()
+		err := l.session()
+		if errors.Is(err, errAgentStopped) {
+			return
+		}
+		l.setStatus(AgentStatus{Err: err.Error()})
+		if time.Since(start) > agentMaxBackoff {
+			backoff = agentMinBackoff
+		}
+		select {
+		case <-time.After(backoff):
+		case <-l.stop:
+			return
+		}
+		if backoff *= 2; backoff > agentMaxBackoff {
+			backoff = agentMaxBackoff
+		}
+	}
+}
+
+// session handles one connection and returns why it ended.
+func (l *agentLink) session() error {
+	nc, err := agentDial(l.deviceID, l.addr)
+	if err != nil {
+		return err
+	}
+	c := agent.NewConn(nc)
+	defer c.Close()
+	st, err := c.Call(agent.Message{Type: agent.MsgHello, Token: appConfig.Agents.Token, DeviceID: l.deviceID}, agentCallTimeout)
+	if err != nil {
+		return fmt.Errorf("hello: %w", err)
+	}
+	l.setStatus(AgentStatus{Connected: true, Locked: st.Locked, Activity: st.Activity})
+
+	ping := time.NewTicker(agentPing)
+	defer ping.Stop()
+	var sent *agentWant
+	for {
+		if w, resend := l.currentWant(); resend || sent == nil || *sent != w {
+			msg := agent.Message{Type: agent.MsgLock}
+			if !w.Locked {
+				msg = agent.Message{Type: agent.MsgUnlock, UserID: w.UserID, UserName: w.UserName}
+			}
+			st, err := c.Call(msg, agentCallTimeout)
+			if err != nil {
+				return fmt.Errorf("%s: %w", msg.Type, err)
+			}
+			sent = &w
+			l.setStatus(AgentStatus{Connected: true, Locked: st.Locked, Activity: st.Activity})
+		}
+		if l.takeShutdown() {
+			if _, err := c.Call(agent.Message{Type: agent.MsgShutdown}, agentCallTimeout); err != nil {
+				fmt.Printf("Shutting down device %d: %v\n", l.deviceID, err)
+				setPowerPending(l.deviceID, "", 0)
+			}
+		}
+		select {
+		case <-l.changed:
+		case <-l.stop:
+			return errAgentStopped
+		case <-ping.C:
+			st, err := c.Call(agent.Message{Type: agent.MsgPing}, agentCallTimeout)
+			if err != nil {
+				return fmt.Errorf("ping: %w", err)
+			}
+			l.setStatus(AgentStatus{Connected: true, Locked: st.Locked, Activity: st.Activity})
+		}
+	}
+}
+
+// setStatus stores the link's latest status, unless stopAgents has dropped
+// the link. Views are only told when something they show changed; idle time
+// counts in whole minutes.
+func (l *agentLink) setStatus(st AgentStatus) {
+	deviceID := l.deviceID
+	agentMu.Lock()
+	if agentLinks[deviceID] != l {
+		agentMu.Unlock()
+		return
+	}
+	prev, had := agentStatus[deviceID]
+	st.Since = time.Now()
+	agentStatus[deviceID] = st
+	agentMu.Unlock()
+	if had && agentStatusView(prev) == agentStatusView(st) {
+		return
+	}
+	if !st.Connected {
+		fmt.Printf("Agent for device %d: %s\n", deviceID, st.Err)
+	}
+	notifyLocal(LoungeEvent{Type: EventAgentStatus, DeviceID: deviceID})
+}
+
+func agentStatusView(st AgentStatus) string {
+	v := fmt.Sprint(st.Connected, st.Locked, st.Err)
+	if a := st.Activity; a != nil {
+		v += fmt.Sprint(a.User, a.Game, a.IdleSeconds/60)
+	}
+	return v
+}
+
+// occupancyMismatch compares a PC's state in the lounge with what its agent
+// sees: a free PC somebody is using, or an occupied one left idle. It returns
+// a short label for the device icon and a sentence for the reconcile dialog.
+func occupancyMismatch(d Device) (label, detail string) {
+	st, ok := agentStatusFor(d.ID)
+	if !ok || !st.Connected || st.Activity == nil {
+		return "", ""
+	}
+	a := st.Activity
+	idle := time.Duration(a.IdleSeconds) * time.Second
+	switch {
+	case d.Status == "free" && (a.Game != "" || (a.User != "" && idle < agentActiveIdle)):
+		detail = fmt.Sprintf("PC %d is free here but in use", d.ID)
+		if a.User != "" {
+			detail += fmt.Sprintf(" by %q", a.User)
+		}
+		if a.Game != "" {
+			detail += fmt.Sprintf(", playing %s", a.Game)
+		}
+		return "In use?", detail + "."
+	case d.Status == "occupied" && a.Game == "" && idle >= appConfig.Agents.idleLimit():
+		return "Idle " + formatIdle(idle), fmt.Sprintf("PC %d has had no input for %s.", d.ID, formatIdle(idle))
+	}
+	return "", ""
+}
+
+func formatIdle(d time.Duration) string {
+	if d >= time.Hour {
+		return fmt.Sprintf("%dh%02dm", int(d.Hours()), int(d.Minutes())%60)
+	}
+	return fmt.Sprintf("%dm", int(d.Minutes()))
+}
+
+func agentStatusFor(deviceID int) (AgentStatus, bool) {
+	agentMu.Lock()
+	defer agentMu.Unlock()
+	if _, ok := agentLinks[deviceID]; !ok {
+		return AgentStatus{}, false
+	}
+	return agentStatus[deviceID], true
+}
+
+// agentDotColor is the marker drawn on a device icon: green when the agent
+// is connected and the PC's lock matches the device, amber while it does
+// not, grey when the agent cannot be reached (the PC is off).
+func agentDotColor(d Device) (color.Color, bool) {
+	st, ok := agentStatusFor(d.ID)
+	if !ok {
+		return nil, false
+	}
+	switch {
+	case !st.Connected:
+		return color.NRGBA{R: 0x9c, G: 0xa0, B: 0xb0, A: 0xff}, true
+	case st.Locked != (d.Status == "free"):
+		return color.NRGBA{R: 0xdf, G: 0x8e, B: 0x1d, A: 0xff}, true
+	default:
+		return color.NRGBA{R: 0x40, G: 0xa0, B: 0x2b, A: 0xff}, true
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"lounge/agent"
+)
+
+// recordingHandler is an in-process agent that reports each command it gets.
+type recordingHandler struct{ calls chan string }
+
+func (h recordingHandler) Lock() error {
+	h.calls <- "lock"
+	return nil
+}
+
+func (h recordingHandler) Unlock(userID, userName string) error {
+	h.calls <- "unlock " + userID + " " + userName
+	return nil
+}
+
+func expectAgentCall(t *testing.T, calls <-chan string, want string) {
+	t.Helper()
+	select {
+	case got := <-calls:
+		if got != want {
+			t.Fatalf("agent got %q, want %q", got, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("agent got nothing, want %q", want)
+	}
+}
+
+// expectAgentLocked waits for the lounge to hear the agent's new state.
+func expectAgentLocked(t *testing.T, deviceID int, want bool) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if st, _ := agentStatusFor(deviceID); st.Connected && st.Locked == want {
+			return
+		}
+	}
+	t.Fatalf("lounge never saw device %d with locked=%v", deviceID, want)
+}
+
+// TestAgentLocksWithCheckIns runs the lounge side against an agent.Server on
+// the other end of a net.Pipe.
+func TestAgentLocksWithCheckIns(t *testing.T) {
+	setupTestLounge(t)
+	appConfig.Agents = AgentsConfig{Token: "secret", Devices: map[string]string{"3": "pipe"}}
+
+	h := recordingHandler{calls: make(chan string, 8)}
+	srv := agent.NewServer("secret", 3, h)
+	agentDial = func(deviceID int, addr string) (net.Conn, error) {
+		lounge, pc := net.Pipe()
+		go srv.ServeConn(pc)
+		return lounge, nil
+	}
+	t.Cleanup(func() { agentDial = dialAgent })
+
+	startAgents()
+	expectAgentCall(t, h.calls, "lock") // PC 3 is free on connect
+
+	if err := registerUser("Ann", "a1", 3, "", "test"); err != nil {
+		t.Fatal(err)
+	}
+	expectAgentCall(t, h.calls, "unlock a1 Ann")
+	expectAgentLocked(t, 3, false)
+
+	if _, err := checkoutUser("a1", "test"); err != nil {
+		t.Fatal(err)
+	}
+	expectAgentCall(t, h.calls, "lock")
+	expectAgentLocked(t, 3, true)
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+)
+
+// ---------- Alert rules ----------
+//
+// Rules from the "rules" list in log/config.json are checked by the main
+// ticker. A rule picks out devices by type, occupancy and session length and
+// can also require a minimum queue; every condition left out is ignored.
+// Matching rules show in the alert banner and ring the devices they matched.
+
+const alertInterval = 30 * time.Second
+
+type AlertRule struct {
+	Name string `json:"name"`
+	// DeviceType limits the rule to "PC" or "Console" devices.
+	DeviceType string `json:"device_type,omitempty"`
+	// Free matches free devices instead of occupied ones (idle stations).
+	Free bool `json:"free,omitempty"`
+	// SessionOverMinutes needs someone on the device for longer than this.
+	SessionOverMinutes int `json:"session_over_minutes,omitempty"`
+	// UsersAtMost needs at most this many people on the device.
+	UsersAtMost int `json:"users_at_most,omitempty"`
+	// QueueAtLeast needs this many people waiting. With QueueType it only
+	// counts those waiting for that device type or for any device.
+	QueueAtLeast int    `json:"queue_at_least,omitempty"`
+	QueueType    string `json:"queue_type,omitempty"`
+}
+
+// devicesMatter is false for rules about the queue alone.
+func (r AlertRule) devicesMatter() bool {
+	return r.DeviceType != "" || r.Free || r.SessionOverMinutes > 0 || r.UsersAtMost > 0
+}
+
+type Alert struct {
+	Rule    string
+	Message string
+	Devices []int
+}
+
+// key identifies an alert for dismissal; it changes when the devices do.
+func (a Alert) key() string { return fmt.Sprint(a.Rule, a.Devices) }
+
+// evaluateRules returns the alerts raised by rules against snap at now.
+func evaluateRules(rules []AlertRule, snap stateSnapshot, now time.Time) []Alert {
+	var alerts []Alert
+	for _, r := range rules {
+		queued := snap.waitingFor(r.QueueType)
+		if r.QueueAtLeast > 0 && queued < r.QueueAtLeast {
+			continue
+		}
+		waiting := fmt.Sprintf("%d waiting", queued)
+		if r.QueueType != "" {
+			waiting += " for a " + r.QueueType
+		}
+		if !r.devicesMatter() {
+			alerts = append(alerts, Alert{Rule: r.Name, Message: r.Name + ": " + waiting})
+			continue
+		}
+		var ids []int
+		var longest time.Duration
+		for _, d := range snap.Devices {
+			if r.DeviceType != "" && !strings.EqualFold(d.Type, r.DeviceType) {
+				continue
+			}
+			if (d.Status == "free") != r.Free {
+				continue
+			}
+			users := snap.usersOn(d.ID)
+			if r.UsersAtMost > 0 && len(users) > r.UsersAtMost {
+				continue
+			}
+			if r.SessionOverMinutes > 0 {
+				var over time.Duration
+				for _, u := range users {
+					if on := now.Sub(u.CheckInTime); on > time.Duration(r.SessionOverMinutes)*time.Minute && on > over {
+						over = on
+					}
+				}
+				if over == 0 {
+					continue
+				}
+				if over > longest {
+					longest = over
+				}
+			}
+			ids = append(ids, d.ID)
+		}
+		if len(ids) == 0 {
+			continue
+		}
+		msg := fmt.Sprintf("%s: %s", r.Name, joinDeviceIDs(ids))
+		if longest > 0 {
+			msg += fmt.Sprintf(" (longest %s)", formatDuration(longest))
+		}
+		if r.QueueAtLeast > 0 {
+			msg += ", " + waiting
+		}
+		alerts = append(alerts, Alert{Rule: r.Name, Message: msg, Devices: ids})
+	}
+	return alerts
+}
+
+func joinDeviceIDs(ids []int) string {
+	parts := make([]string, len(ids))
+	for i, id := range ids {
+		parts[i] = fmt.Sprint(id)
+	}
+	if len(ids) == 1 {
+		return "device " + parts[0]
+	}
+	return "devices " + strings.Join(parts, ", ")
+}
+
+// ---------- Alert banner ----------
+
+// Fyne thread only.
+var (
+	activeAlerts    []Alert
+	alertDevices    = map[int]bool{}
+	dismissedAlerts = map[string]bool{}
+	alertBanner     *fyne.Container
+	alertLabel      *widget.Label
+)
+
+func buildAlertBanner() fyne.CanvasObject {
+	alertLabel = widget.NewLabel("")
+	alertLabel.Wrapping = fyne.TextWrapWord
+	alertLabel.Importance = widget.DangerImportance
+	dismiss := widget.NewButtonWithIcon("Dismiss", theme.CancelIcon(), func() {
+		for _, a := range activeAlerts {
+			dismissedAlerts[a.key()] = true
+		}
+		showAlerts(activeAlerts)
+	})
+	alertBanner = container.NewBorder(nil, nil, widget.NewIcon(theme.WarningIcon()), dismiss, alertLabel)
+	alertBanner.Hide()
+	return alertBanner
+}
+
+// checkAlertRules runs on the Fyne thread from the main ticker.
+func checkAlertRules(now time.Time) {
+	if len(appConfig.Rules) == 0 {
+		return
+	}
+	alerts := evaluateRules(appConfig.Rules, snapshotState(), now)
+	previous := map[string]bool{}
+	for _, a := range activeAlerts {
+		previous[a.key()] = true
+	}
+	for _, a := range alerts {
+		if !previous[a.key()] {
+			d := 0
+			if len(a.Devices) > 0 {
+				d = a.Devices[0]
+			}
+			publishEvent(LoungeEvent{Type: EventAlert, DeviceID: d, Message: a.Message})
+		}
+	}
+	showAlerts(alerts)
+}
+
+// showAlerts updates the banner and the highlighted devices. Dismissed
+// alerts stay hidden until their condition clears.
+func showAlerts(alerts []Alert) {
+	activeAlerts = alerts
+	current := map[string]bool{}
+	for _, a := range alerts {
+		current[a.key()] = true
+	}
+	for k := range dismissedAlerts {
+		if !current[k] {
+			delete(dismissedAlerts, k)
+		}
+	}
+
+	var lines []string
+	devices := map[int]bool{}
+	for _, a := range alerts {
+		if dismissedAlerts[a.key()] {
+			continue
+		}
+		lines = append(lines, a.Message)
+		for _, id := range a.Devices {
+			devices[id] = true
+		}
+	}
+	sort.Strings(lines)
+	changed := len(devices) != len(alertDevices)
+	for id := range devices {
+		changed = changed || !alertDevices[id]
+	}
+	alertDevices = devices
+	if changed && deviceLayout != nil {
+		deviceLayout.Refresh()
+	}
+	if alertBanner == nil {
+		return
+	}
+	if len(lines) == 0 {
+		alertBanner.Hide()
+		return
+	}
+	alertLabel.SetText(strings.Join(lines, "\n"))
+	alertBanner.Show()
+}
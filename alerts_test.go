@@ -0,0 +1,26 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// TestQueueTypeRule checks that a queue_type rule counts only the users
+// waiting for that device type or for any device.
+func TestQueueTypeRule(t *testing.T) {
+	snap := stateSnapshot{Users: []User{
+		{ID: "a", WantType: "Console"},
+		{ID: "b", WantType: "PC"},
+		{ID: "c"},
+		{ID: "d", PCID: 3},
+	}}
+	rules := []AlertRule{
+		{Name: "Consoles", QueueAtLeast: 2, QueueType: "console"},
+		{Name: "PCs", QueueAtLeast: 3, QueueType: "PC"},
+		{Name: "Anyone", QueueAtLeast: 3},
+	}
+	alerts := evaluateRules(rules, snap, time.Now())
+	if len(alerts) != 2 || alerts[0].Message != "Consoles: 2 waiting for a console" || alerts[1].Message != "Anyone: 3 waiting" {
+		t.Fatalf("got %+v", alerts)
+	}
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ---------- Local HTTP API ----------
+
+type apiCheckInRequest struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	DeviceID int    `json:"device_id"`
+	Game     string `json:"game,omitempty"`
+	// Event is the ID of the running event the user checks in for.
+	Event string `json:"event,omitempty"`
+	// AfterHours lets the check-in through while the lounge is closed.
+	AfterHours bool `json:"after_hours"`
+	// WantType is the device type a queued user waits for; empty for any.
+	WantType string `json:"want_type,omitempty"`
+}
+
+type apiUserRequest struct {
+	ID string `json:"id"`
+}
+
+type apiDeviceRequest struct {
+	ID       string `json:"id"`
+	DeviceID int    `json:"device_id"`
+}
+
+type apiSwapRequest struct {
+	ID      string `json:"id"`
+	OtherID string `json:"other_id"`
+}
+
+// apiCheckoutResponse lists what the user left without returning.
+type apiCheckoutResponse struct {
+	OK       bool   `json:"ok"`
+	Borrowed []Loan `json:"borrowed,omitempty"`
+}
+
+func newAPIHandler(token string) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /api/status", func(w http.ResponseWriter, r *http.Request) {
+		var v statusView
+		withState(func() { v = buildStatusView() })
+		writeAPIJSON(w, http.StatusOK, v)
+	})
+	mux.HandleFunc("GET /api/devices", func(w http.ResponseWriter, r *http.Request) {
+		var v []deviceView
+		withState(func() { v = buildStatusView().Devices })
+		writeAPIJSON(w, http.StatusOK, v)
+	})
+	mux.HandleFunc("GET /api/users", func(w http.ResponseWriter, r *http.Request) {
+		var v []User
+		withState(func() { v = append([]User{}, activeUsers...) })
+		writeAPIJSON(w, http.StatusOK, v)
+	})
+	mux.HandleFunc("GET /api/queue", func(w http.ResponseWriter, r *http.Request) {
+		var v []User
+		withState(func() { v = getPendingUsers() })
+		writeAPIJSON(w, http.StatusOK, v)
+	})
+	mux.HandleFunc("GET /api/members", func(w http.ResponseWriter, r *http.Request) {
+		writeAPIJSON(w, http.StatusOK, snapshotMembers())
+	})
+	mux.HandleFunc("GET /api/logs", func(w http.ResponseWriter, r *http.Request) {
+		day := time.Now()
+		if q := r.URL.Query().Get("date"); q != "" {
+			d, err := time.ParseInLocation("2006-01-02", q, time.Local)
+			if err != nil {
+				writeAPIError(w, http.StatusBadRequest, fmt.Errorf("invalid date: %w", err))
+				return
+			}
+			day = d
+		}
+		entries, err := readLogEntriesLocked(logFilePathForDate(day))
+		if err != nil {
+			writeAPIError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeAPIJSON(w, http.StatusOK, entries)
+	})
+
+	mux.HandleFunc("GET /api/events", serveEventStream)
+
+	mux.HandleFunc("POST /api/checkin", func(w http.ResponseWriter, r *http.Request) {
+		var req apiCheckInRequest
+		if !decodeAPIRequest(w, r, &req) {
+			return
+		}
+		if req.ID = strings.TrimSpace(req.ID); req.ID == "" {
+			writeAPIError(w, http.StatusBadRequest, errors.New("id is required"))
+			return
+		}
+		runAPIMutation(w, req.ID, func() error {
+			name, err := resolveMemberName(req.ID, req.Name)
+			if err != nil {
+				return err
+			}
+			return registerUserHours(name, req.ID, req.DeviceID, req.Game, req.Event, req.WantType, actorAPI, req.AfterHours)
+		})
+	})
+	mux.HandleFunc("POST /api/checkout", func(w http.ResponseWriter, r *http.Request) {
+		var req apiUserRequest
+		if !decodeAPIRequest(w, r, &req) {
+			return
+		}
+		loans, err := checkoutUser(req.ID, actorAPI)
+		if err != nil {
+			writeAPIError(w, http.StatusConflict, err)
+			return
+		}
+		writeAPIJSON(w, http.StatusOK, apiCheckoutResponse{OK: true, Borrowed: loans})
+	})
+	mux.HandleFunc("POST /api/assign", func(w http.ResponseWriter, r *http.Request) {
+		var req apiDeviceRequest
+		if !decodeAPIRequest(w, r, &req) {
+			return
+		}
+		runAPIMutation(w, req.ID, func() error { return assignQueuedUserToDevice(req.ID, req.DeviceID, actorAPI) })
+	})
+	mux.HandleFunc("POST /api/switch", func(w http.ResponseWriter, r *http.Request) {
+		var req apiDeviceRequest
+		if !decodeAPIRequest(w, r, &req) {
+			return
+		}
+		runAPIMutation(w, req.ID, func() error { return switchUserStation(req.ID, req.DeviceID, actorAPI) })
+	})
+	mux.HandleFunc("POST /api/swap", func(w http.ResponseWriter, r *http.Request) {
+		var req apiSwapRequest
+		if !decodeAPIRequest(w, r, &req) {
+			return
+		}
+		runAPIMutation(w, req.ID, func() error { return swapUsers(req.ID, req.OtherID, actorAPI) })
+	})
+
+	root := http.NewServeMux()
+	if appConfig.Board.Web {
+		root.HandleFunc("GET /board", serveBoardPage)
+		root.HandleFunc("GET /board.json", serveBoardJSON)
+	}
+	root.Handle("/", requireAPIToken(token, mux))
+	return root
+}
+
+// requireAPIToken accepts "Authorization: Bearer <token>", "X-API-Token", or
+// a ?token= query parameter for browser EventSource clients that cannot set
+// headers.
+func requireAPIToken(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got := r.URL.Query().Get("token")
+		if h := r.Header.Get("X-API-Token"); h != "" {
+			got = h
+		}
+		if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+			got = strings.TrimPrefix(auth, "Bearer ")
+		}
+		if subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			writeAPIError(w, http.StatusUnauthorized, errors.New("missing or invalid API token"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func decodeAPIRequest(w http.ResponseWriter, r *http.Request, v any) bool {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		writeAPIError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+		return false
+	}
+	return true
+}
+
+// runAPIMutation applies op to the lounge state and answers with the user
+// record for userID afterwards, or the error as a 409.
+func runAPIMutation(w http.ResponseWriter, userID string, op func() error) {
+	if err := op(); err != nil {
+		writeAPIError(w, http.StatusConflict, err)
+		return
+	}
+	var user *User
+	if userID != "" {
+		user = snapshotState().user(userID)
+	}
+	if user == nil {
+		writeAPIJSON(w, http.StatusOK, map[string]bool{"ok": true})
+		return
+	}
+	writeAPIJSON(w, http.StatusOK, user)
+}
+
+func writeAPIJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeAPIError(w http.ResponseWriter, status int, err error) {
+	writeAPIJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+// startAPIServer listens on cfg.Addr in the background. It refuses to start
+// without a token so the endpoints are never left open.
+func startAPIServer(cfg APIConfig) (*http.Server, error) {
+	if cfg.Token == "" {
+		return nil, errors.New("api: a token is required in config")
+	}
+	srv := &http.Server{
+		Addr:              cfg.Addr,
+		Handler:           newAPIHandler(cfg.Token),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	ln, err := net.Listen("tcp", cfg.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("api: listen %s: %w", cfg.Addr, err)
+	}
+	go func() {
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fmt.Println("API server stopped:", err)
+		}
+	}()
+	return srv, nil
+}
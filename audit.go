@@ -0,0 +1,329 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/widget"
+)
+
+// ---------- Audit trail ----------
+//
+// log/audit.jsonl gets one JSON record per staff action, failed attempts
+// included. Each record carries the hash of the one before it, so changing or
+// removing a past record breaks the chain from that point on.
+
+const auditFile = "log/audit.jsonl"
+
+// Audit actions beyond the lounge event types (checkin, checkout, ...).
+const (
+	auditLayout       = "layout"
+	auditMemberAdd    = "member_add"
+	auditStaffSave    = "staff_save"
+	auditStaffRemove  = "staff_remove"
+	auditLogin        = "login"
+	auditLoginFailed  = "login_failed"
+	auditLock         = "lock"
+	auditDenied       = "permission_denied"
+	auditKioskStart   = "kiosk_start"
+	auditKioskExit    = "kiosk_exit"
+	auditKioskExitBad = "kiosk_exit_failed"
+)
+
+type AuditRecord struct {
+	Seq    uint64          `json:"seq"`
+	Time   time.Time       `json:"time"`
+	Actor  string          `json:"actor"`
+	Action string          `json:"action"`
+	Target string          `json:"target,omitempty"`
+	OK     bool            `json:"ok"`
+	Error  string          `json:"error,omitempty"`
+	Before json.RawMessage `json:"before,omitempty"`
+	After  json.RawMessage `json:"after,omitempty"`
+	Prev   string          `json:"prev"`
+	Hash   string          `json:"hash"`
+}
+
+// recordAudit appends a record; opErr marks a failed attempt. before and
+// after are stored as JSON and may be nil.
+func recordAudit(actor, action, target string, before, after any, opErr error) {
+	rec := AuditRecord{
+		Time:   time.Now(),
+		Actor:  actor,
+		Action: action,
+		Target: target,
+		OK:     opErr == nil,
+		Before: auditValue(before),
+		After:  auditValue(after),
+	}
+	if opErr != nil {
+		rec.Error = opErr.Error()
+	}
+	err := withDataLock(func() error {
+		last, err := lastAuditRecord()
+		if err != nil {
+			return err
+		}
+		rec.Seq = last.Seq + 1
+		rec.Prev = last.Hash
+		rec.Hash = auditHash(rec)
+		line, err := json.Marshal(rec)
+		if err != nil {
+			return err
+		}
+		f, err := os.OpenFile(auditFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+		if err != nil {
+			return err
+		}
+		if _, err := f.Write(append(line, '\n')); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	})
+	if err != nil {
+		fmt.Println("Error writing audit log:", err)
+	}
+}
+
+func auditValue(v any) json.RawMessage {
+	if v == nil {
+		return nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil || string(b) == "null" {
+		return nil
+	}
+	return b
+}
+
+// auditHash covers every field except Hash itself, Prev included.
+func auditHash(rec AuditRecord) string {
+	rec.Hash = ""
+	b, _ := json.Marshal(rec)
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// lastAuditRecord reads only the tail of the file. Call under withDataLock.
+func lastAuditRecord() (AuditRecord, error) {
+	var rec AuditRecord
+	f, err := os.Open(auditFile)
+	if os.IsNotExist(err) {
+		return rec, nil
+	}
+	if err != nil {
+		return rec, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return rec, err
+	}
+	size := fi.Size()
+	chunk := int64(64 << 10)
+	if chunk > size {
+		chunk = size
+	}
+	buf := make([]byte, chunk)
+	if _, err := f.ReadAt(buf, size-chunk); err != nil && err != io.EOF {
+		return rec, err
+	}
+	buf = bytes.TrimRight(buf, "\n")
+	if len(buf) == 0 {
+		return rec, nil
+	}
+	i := bytes.LastIndexByte(buf, '\n')
+	if i < 0 && chunk < size {
+		return rec, fmt.Errorf("%s: last record is longer than %d bytes", auditFile, chunk)
+	}
+	if err := json.Unmarshal(buf[i+1:], &rec); err != nil {
+		return rec, fmt.Errorf("%s: last record: %w", auditFile, err)
+	}
+	return rec, nil
+}
+
+func readAuditRecords() ([]AuditRecord, error) {
+	var recs []AuditRecord
+	err := withDataLock(func() error {
+		f, err := os.Open(auditFile)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		sc := bufio.NewScanner(f)
+		sc.Buffer(make([]byte, 0, 64<<10), 1<<20)
+		for line := 1; sc.Scan(); line++ {
+			if len(bytes.TrimSpace(sc.Bytes())) == 0 {
+				continue
+			}
+			var rec AuditRecord
+			if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+				return fmt.Errorf("%s line %d: %w", auditFile, line, err)
+			}
+			recs = append(recs, rec)
+		}
+		return sc.Err()
+	})
+	return recs, err
+}
+
+// verifyAuditChain returns the index of the first record that does not fit
+// the chain and why, or -1 when every record checks out.
+func verifyAuditChain(recs []AuditRecord) (int, string) {
+	prev := AuditRecord{}
+	for i, rec := range recs {
+		switch {
+		case rec.Seq != prev.Seq+1:
+			return i, fmt.Sprintf("record %d follows %d", rec.Seq, prev.Seq)
+		case rec.Prev != prev.Hash:
+			return i, fmt.Sprintf("record %d does not link to the record before it", rec.Seq)
+		case auditHash(rec) != rec.Hash:
+			return i, fmt.Sprintf("record %d has been modified", rec.Seq)
+		}
+		prev = rec
+	}
+	return -1, ""
+}
+
+func auditChainSummary(recs []AuditRecord) string {
+	if i, why := verifyAuditChain(recs); i >= 0 {
+		return "Audit chain broken: " + why
+	}
+	return fmt.Sprintf("Audit chain intact (%d records)", len(recs))
+}
+
+// ---------- Audit viewer ----------
+
+func showAuditViewer() {
+	if !requirePermission(permAuditView, "view the audit log") {
+		return
+	}
+	recs, err := readAuditRecords()
+	if err != nil {
+		fmt.Println("Error reading audit log:", err)
+	}
+
+	summary := widget.NewLabel(auditChainSummary(recs))
+	if i, _ := verifyAuditChain(recs); i >= 0 {
+		summary.Importance = widget.DangerImportance
+	}
+
+	const anyOption = "(any)"
+	actors, actions := []string{anyOption}, []string{anyOption}
+	seenActor, seenAction := map[string]bool{}, map[string]bool{}
+	for _, r := range recs {
+		if !seenActor[r.Actor] {
+			seenActor[r.Actor] = true
+			actors = append(actors, r.Actor)
+		}
+		if !seenAction[r.Action] {
+			seenAction[r.Action] = true
+			actions = append(actions, r.Action)
+		}
+	}
+	actorSelect := widget.NewSelect(actors, nil)
+	actorSelect.SetSelected(anyOption)
+	actionSelect := widget.NewSelect(actions, nil)
+	actionSelect.SetSelected(anyOption)
+	failedOnly := widget.NewCheck("Failed only", nil)
+	search := widget.NewEntry()
+	search.SetPlaceHolder("Search target, values or errors")
+
+	// Newest first.
+	shown := []AuditRecord{}
+	filter := func() {
+		q := strings.ToLower(strings.TrimSpace(search.Text))
+		shown = shown[:0]
+		for i := len(recs) - 1; i >= 0; i-- {
+			r := recs[i]
+			if actorSelect.Selected != anyOption && r.Actor != actorSelect.Selected {
+				continue
+			}
+			if actionSelect.Selected != anyOption && r.Action != actionSelect.Selected {
+				continue
+			}
+			if failedOnly.Checked && r.OK {
+				continue
+			}
+			if q != "" && !strings.Contains(strings.ToLower(r.Target+" "+r.Error+" "+string(r.Before)+" "+string(r.After)), q) {
+				continue
+			}
+			shown = append(shown, r)
+		}
+	}
+
+	headers := []string{"#", "Time", "Staff", "Action", "Target", "Result", "Before", "After"}
+	table := widget.NewTable(
+		func() (int, int) { return len(shown) + 1, len(headers) },
+		func() fyne.CanvasObject { return widget.NewLabel("") },
+		func(id widget.TableCellID, o fyne.CanvasObject) {
+			l := o.(*widget.Label)
+			l.Truncation = fyne.TextTruncateEllipsis
+			if id.Row == 0 {
+				l.TextStyle.Bold = true
+				l.SetText(headers[id.Col])
+				return
+			}
+			l.TextStyle.Bold = false
+			r := shown[id.Row-1]
+			var text string
+			switch id.Col {
+			case 0:
+				text = fmt.Sprint(r.Seq)
+			case 1:
+				text = r.Time.Format("Jan 02 15:04:05")
+			case 2:
+				text = r.Actor
+			case 3:
+				text = r.Action
+			case 4:
+				text = r.Target
+			case 5:
+				text = "ok"
+				if !r.OK {
+					text = "failed: " + r.Error
+				}
+			case 6:
+				text = string(r.Before)
+			case 7:
+				text = string(r.After)
+			}
+			l.SetText(text)
+		},
+	)
+	for col, w := range []float32{50, 130, 90, 110, 140, 160, 220, 220} {
+		table.SetColumnWidth(col, w)
+	}
+
+	refresh := func() { filter(); table.Refresh() }
+	actorSelect.OnChanged = func(string) { refresh() }
+	actionSelect.OnChanged = func(string) { refresh() }
+	failedOnly.OnChanged = func(bool) { refresh() }
+	search.OnChanged = func(string) { refresh() }
+	filter()
+
+	filters := container.NewGridWithColumns(4,
+		container.NewBorder(nil, nil, widget.NewLabel("Staff"), nil, actorSelect),
+		container.NewBorder(nil, nil, widget.NewLabel("Action"), nil, actionSelect),
+		failedOnly,
+		search,
+	)
+	w := fyne.CurrentApp().NewWindow("Audit Log")
+	w.SetContent(container.NewBorder(container.NewVBox(summary, filters, widget.NewSeparator()), nil, nil, nil, table))
+	w.Resize(fyne.NewSize(1100, 600))
+	w.Show()
+}
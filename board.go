@@ -0,0 +1,376 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/layout"
+	"fyne.io/fyne/v2/theme"
+)
+
+// ---------- Public status board ----------
+
+const (
+	boardStateFree     = "free"
+	boardStateBusy     = "busy"
+	boardStateReserved = "reserved"
+
+	// defaultSessionLength is assumed for wait estimates until today's log
+	// has finished sessions to average.
+	defaultSessionLength = time.Hour
+	minRemainingSession  = 5 * time.Minute
+)
+
+type boardDevice struct {
+	ID    int      `json:"id"`
+	Type  string   `json:"type"`
+	State string   `json:"state"`
+	Row   int      `json:"row"` // -1 for the side column
+	Col   int      `json:"col"`
+	Names []string `json:"names,omitempty"`
+}
+
+type boardView struct {
+	Devices              []boardDevice `json:"devices"`
+	Rows                 []int         `json:"rows"`
+	FreePCs              int           `json:"free_pcs"`
+	QueueLength          int           `json:"queue_length"`
+	EstimatedWaitMinutes int           `json:"estimated_wait_minutes"`
+	Updated              time.Time     `json:"updated"`
+}
+
+var (
+	statusBoardWindow  fyne.Window
+	statusBoardContent *fyne.Container
+)
+
+func boardState(d Device) string {
+	switch d.Status {
+	case "free":
+		return boardStateFree
+	case "occupied":
+		return boardStateBusy
+	}
+	return boardStateReserved
+}
+
+// averageSessionLength averages today's finished device sessions.
+func averageSessionLength() time.Duration {
+	entries, err := readLogEntriesLocked(getLogFilePath())
+	if err != nil {
+		return defaultSessionLength
+	}
+	var total time.Duration
+	n := 0
+	for _, e := range entries {
+		if e.PCID == 0 || e.CheckOutTime.IsZero() {
+			continue
+		}
+		total += e.CheckOutTime.Sub(e.CheckInTime)
+		n++
+	}
+	if n == 0 {
+		return defaultSessionLength
+	}
+	return total / time.Duration(n)
+}
+
+// estimateWait guesses how long someone joining the back of the queue waits
+// for a PC, assuming every session runs for avg.
+func estimateWait(queueLen int, avg time.Duration) time.Duration {
+	free := 0
+	remaining := []time.Duration{}
+	now := time.Now()
+	for _, d := range allDevices {
+		if d.Type != "PC" {
+			continue
+		}
+		switch d.Status {
+		case "free":
+			if reservationLocked(d.ID, now) == nil {
+				free++
+			}
+		case "occupied":
+			left := avg
+			if u := getUserByID(d.UserID); u != nil {
+				left = avg - time.Since(u.CheckInTime)
+			}
+			if left < minRemainingSession {
+				left = minRemainingSession
+			}
+			remaining = append(remaining, left)
+		}
+	}
+	ahead := queueLen - free
+	if ahead < 0 || len(remaining) == 0 {
+		return 0
+	}
+	sort.Slice(remaining, func(i, j int) bool { return remaining[i] < remaining[j] })
+	rounds := ahead / len(remaining)
+	return remaining[ahead%len(remaining)] + time.Duration(rounds)*avg
+}
+
+// buildBoardView must run holding the state lock (see withState).
+func buildBoardView(showNames bool, avg time.Duration) boardView {
+	slots := floorSlots()
+
+	v := boardView{Devices: []boardDevice{}, Rows: layoutRows, Updated: time.Now()}
+	for _, d := range allDevices {
+		row, col := slotRowCol(slots[d.ID])
+		bd := boardDevice{ID: d.ID, Type: d.Type, State: boardState(d), Row: row, Col: col}
+		if bd.State == boardStateFree && reservationLocked(d.ID, v.Updated) != nil {
+			bd.State = boardStateReserved
+		}
+		if showNames {
+			for _, u := range usersOnDevice(d.ID) {
+				bd.Names = append(bd.Names, firstLast(u.Name))
+			}
+		}
+		if d.Type == "PC" && bd.State == boardStateFree {
+			v.FreePCs++
+		}
+		v.Devices = append(v.Devices, bd)
+	}
+	v.QueueLength = len(getPendingUsers())
+	v.EstimatedWaitMinutes = int(estimateWait(v.QueueLength, avg).Round(time.Minute).Minutes())
+	return v
+}
+
+// ---------- Board window ----------
+
+func boardColor(state string) color.Color {
+	switch state {
+	case boardStateFree:
+		return latteGreen
+	case boardStateBusy:
+		return latteRed
+	}
+	return latteYellow
+}
+
+func boardTile(d boardDevice) fyne.CanvasObject {
+	bg := canvas.NewRectangle(boardColor(d.State))
+	bg.CornerRadius = 10
+	bg.SetMinSize(fyne.NewSize(130, 96))
+
+	label := fmt.Sprintf("%s %d", d.Type, d.ID)
+	title := canvas.NewText(label, color.White)
+	title.TextSize = 22
+	title.TextStyle.Bold = true
+	title.Alignment = fyne.TextAlignCenter
+
+	sub := canvas.NewText(strings.ToUpper(d.State), color.White)
+	sub.TextSize = 13
+	sub.Alignment = fyne.TextAlignCenter
+	lines := container.NewVBox(title, sub)
+	if len(d.Names) > 0 {
+		names := canvas.NewText(strings.Join(d.Names, ", "), color.White)
+		names.TextSize = 12
+		names.Alignment = fyne.TextAlignCenter
+		lines.Add(names)
+	}
+	return container.NewStack(bg, container.NewCenter(lines))
+}
+
+func buildBoardContent(v boardView) fyne.CanvasObject {
+	bySlot := map[[2]int]boardDevice{}
+	side := []boardDevice{}
+	for _, d := range v.Devices {
+		if d.Row < 0 {
+			side = append(side, d)
+			continue
+		}
+		bySlot[[2]int{d.Row, d.Col}] = d
+	}
+	sort.Slice(side, func(i, j int) bool { return side[i].Col < side[j].Col })
+
+	rows := container.NewVBox()
+	for r, cols := range v.Rows {
+		row := container.NewHBox(layout.NewSpacer())
+		for c := 0; c < cols; c++ {
+			if d, ok := bySlot[[2]int{r, c}]; ok {
+				row.Add(boardTile(d))
+			}
+		}
+		row.Add(layout.NewSpacer())
+		rows.Add(row)
+	}
+	sideCol := container.NewVBox(layout.NewSpacer())
+	for _, d := range side {
+		sideCol.Add(boardTile(d))
+		sideCol.Add(layout.NewSpacer())
+	}
+
+	heading := canvas.NewText("Lounge Status", theme.ForegroundColor())
+	heading.TextSize = 34
+	heading.TextStyle.Bold = true
+
+	wait := "No wait"
+	if v.EstimatedWaitMinutes > 0 {
+		wait = fmt.Sprintf("Estimated wait: ~%d min", v.EstimatedWaitMinutes)
+	}
+	summary := canvas.NewText(fmt.Sprintf("Free PCs: %d   |   In queue: %d   |   %s", v.FreePCs, v.QueueLength, wait), theme.ForegroundColor())
+	summary.TextSize = 22
+
+	updated := canvas.NewText("Updated "+v.Updated.Format("15:04"), color.NRGBA{A: 255, R: 150, G: 150, B: 160})
+	updated.TextSize = 12
+
+	legend := container.NewHBox(
+		boardLegendItem("Free", boardStateFree),
+		boardLegendItem("Busy", boardStateBusy),
+		boardLegendItem("Reserved", boardStateReserved),
+		layout.NewSpacer(),
+		updated,
+	)
+
+	floor := container.NewBorder(nil, nil, nil, container.NewPadded(sideCol), container.NewCenter(rows))
+	top := container.NewVBox(heading, summary)
+	return container.NewPadded(container.NewBorder(top, legend, nil, nil, floor))
+}
+
+func boardLegendItem(text, state string) fyne.CanvasObject {
+	swatch := canvas.NewRectangle(boardColor(state))
+	swatch.SetMinSize(fyne.NewSize(18, 18))
+	lbl := canvas.NewText(text, theme.ForegroundColor())
+	lbl.TextSize = 14
+	return container.NewHBox(container.NewCenter(swatch), lbl, layout.NewSpacer())
+}
+
+// showStatusBoard opens the visitor-facing board full screen. Escape closes it.
+func showStatusBoard() {
+	if statusBoardWindow != nil {
+		statusBoardWindow.RequestFocus()
+		return
+	}
+	w := fyne.CurrentApp().NewWindow("Lounge Status")
+	statusBoardWindow = w
+	statusBoardContent = container.NewStack()
+	w.SetContent(statusBoardContent)
+	w.Resize(fyne.NewSize(1280, 800))
+	w.SetFullScreen(true)
+	w.Canvas().SetOnTypedKey(func(ev *fyne.KeyEvent) {
+		if ev.Name == fyne.KeyEscape {
+			w.Close()
+		}
+	})
+
+	stop := make(chan struct{})
+	w.SetOnClosed(func() {
+		close(stop)
+		statusBoardWindow = nil
+		statusBoardContent = nil
+	})
+	refreshStatusBoard()
+	w.Show()
+
+	// Wait estimates drift with time even when nothing changes.
+	go func() {
+		t := time.NewTicker(time.Minute)
+		defer t.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-t.C:
+				fyne.Do(refreshStatusBoard)
+			}
+		}
+	}()
+}
+
+// refreshStatusBoard redraws the board window if it is open. Call on the UI
+// thread.
+func refreshStatusBoard() {
+	if statusBoardContent == nil {
+		return
+	}
+	avg := averageSessionLength()
+	var v boardView
+	withState(func() { v = buildBoardView(appConfig.Board.ShowNames, avg) })
+	statusBoardContent.Objects = []fyne.CanvasObject{buildBoardContent(v)}
+	statusBoardContent.Refresh()
+}
+
+// ---------- Board web page ----------
+
+func serveBoardJSON(w http.ResponseWriter, r *http.Request) {
+	avg := averageSessionLength()
+	var v boardView
+	withState(func() { v = buildBoardView(appConfig.Board.ShowNames, avg) })
+	writeAPIJSON(w, http.StatusOK, v)
+}
+
+func serveBoardPage(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, _ = w.Write([]byte(boardPageHTML))
+}
+
+const boardPageHTML = `<!doctype html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Lounge Status</title>
+<style>
+  body { margin: 0; padding: 24px; font-family: sans-serif; background: #eff1f5; color: #4c4f69; }
+  h1 { margin: 0 0 4px; font-size: 40px; }
+  #summary { font-size: 24px; margin-bottom: 24px; }
+  #floor { display: flex; gap: 48px; align-items: center; justify-content: center; }
+  .row { display: flex; justify-content: center; gap: 16px; margin-bottom: 16px; }
+  .side { display: flex; flex-direction: column; gap: 96px; }
+  .tile { width: 140px; height: 100px; border-radius: 10px; color: #fff; display: flex;
+          flex-direction: column; align-items: center; justify-content: center; }
+  .tile b { font-size: 22px; }
+  .tile small { font-size: 12px; }
+  .free { background: #40a02b; } .busy { background: #d20f39; } .reserved { background: #df8e1d; }
+  #updated { margin-top: 16px; color: #9696a0; font-size: 12px; }
+</style>
+</head>
+<body>
+<h1>Lounge Status</h1>
+<div id="summary"></div>
+<div id="floor"><div id="rows"></div><div class="side" id="side"></div></div>
+<div id="updated"></div>
+<script>
+function tile(d) {
+  const el = document.createElement("div");
+  el.className = "tile " + d.state;
+  el.innerHTML = "<b></b><span></span><small></small>";
+  el.querySelector("b").textContent = d.type + " " + d.id;
+  el.querySelector("span").textContent = d.state.toUpperCase();
+  el.querySelector("small").textContent = (d.names || []).join(", ");
+  return el;
+}
+async function load() {
+  try {
+    const v = await (await fetch("board.json")).json();
+    const wait = v.estimated_wait_minutes > 0 ? "Estimated wait: ~" + v.estimated_wait_minutes + " min" : "No wait";
+    document.getElementById("summary").textContent =
+      "Free PCs: " + v.free_pcs + " | In queue: " + v.queue_length + " | " + wait;
+    const rows = document.getElementById("rows"), side = document.getElementById("side");
+    rows.replaceChildren(); side.replaceChildren();
+    v.rows.forEach((cols, r) => {
+      const row = document.createElement("div");
+      row.className = "row";
+      v.devices.filter(d => d.row === r).sort((a, b) => a.col - b.col).forEach(d => row.appendChild(tile(d)));
+      rows.appendChild(row);
+    });
+    v.devices.filter(d => d.row < 0).sort((a, b) => a.col - b.col).forEach(d => side.appendChild(tile(d)));
+    document.getElementById("updated").textContent = "Updated " + new Date(v.updated).toLocaleTimeString();
+  } catch (e) {
+    document.getElementById("updated").textContent = "Connection lost, retrying...";
+  }
+}
+load();
+setInterval(load, 10000);
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,961 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// ---------- Command-line interface ----------
+
+const cliUsage = `Usage: lounge [--dir DIR] [--kiosk] <command> [options]
+
+Without a command the desktop window is started (in kiosk mode with --kiosk).
+
+Commands:
+  status                          show devices and who is on them
+  checkin --id ID [--name NAME] [--device N] [--game GAME] [--event ID]
+          [--want TYPE] [--after-hours]
+                                  check a user in (no device = join the queue,
+                                  waiting for a TYPE device if given)
+  group ID[=NAME]... [--after-hours]
+                                  seat a group on adjacent PCs, or queue them
+                                  to be seated together
+  checkout --id ID                check a user out or remove them from the queue
+  queue                           list queued users
+  close                           check out everyone left from before the
+                                  last closing time (for cron without a window)
+  wake --all | ID...              send Wake-on-LAN packets to devices
+  equipment                       list lendable items and who has them
+  equipment add NAME [--kind KIND]
+  equipment lend ITEM --id ID     lend an item (ID or name) to a checked-in user
+  equipment return ITEM           take an item back
+  equipment history [--item ITEM] [--id ID]
+                                  list loans, newest last
+  events                          list current and upcoming events
+  events add --name NAME --date DATE --start HH:MM --end HH:MM --devices LIST
+                                  hold devices (e.g. "1-8,17") for an event
+  events end ID                   end a running event, or delete a future one
+  members import FILE             add members from a CSV file
+  members export [FILE]           write members as CSV (stdout by default)
+  report [--from DATE] [--to DATE]
+                                  summarise the daily logs (DATE is YYYY-MM-DD)
+  serve [--addr ADDR]             run the HTTP API without a window
+  audit [--actor ID] [--action A] [--limit N]
+                                  list recent audit records, newest last
+  audit verify                    check the audit log's hash chain
+
+Most commands accept --json for machine-readable output.
+`
+
+type cliCommand func(args []string, out io.Writer) error
+
+func cliCommands() map[string]cliCommand {
+	return map[string]cliCommand{
+		"status":    cliStatus,
+		"checkin":   cliCheckIn,
+		"group":     cliGroup,
+		"checkout":  cliCheckOut,
+		"queue":     cliQueue,
+		"close":     cliClose,
+		"wake":      cliWake,
+		"equipment": cliEquipment,
+		"events":    cliEvents,
+		"members":   cliMembers,
+		"report":    cliReport,
+		"serve":     cliServe,
+		"audit":     cliAudit,
+	}
+}
+
+// runCLI dispatches a subcommand. It reports handled=false when no command
+// was given so the caller can start the GUI instead.
+func runCLI(args []string) (handled bool, code int) {
+	global := flag.NewFlagSet("lounge", flag.ContinueOnError)
+	global.SetOutput(os.Stderr)
+	global.Usage = func() { fmt.Fprint(os.Stderr, cliUsage) }
+	dir := global.String("dir", "", "data directory containing log/ and membership.csv")
+	global.BoolVar(&startInKiosk, "kiosk", false, "start the window in self-service kiosk mode")
+	if err := global.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return true, 0
+		}
+		return true, 2
+	}
+	if *dir != "" {
+		if err := os.Chdir(*dir); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			return true, 1
+		}
+	}
+	if global.NArg() == 0 {
+		return false, 0
+	}
+
+	name := global.Arg(0)
+	if name == "help" {
+		fmt.Print(cliUsage)
+		return true, 0
+	}
+	cmd, ok := cliCommands()[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", name, cliUsage)
+		return true, 2
+	}
+
+	startHeadless()
+	err := cmd(global.Args()[1:], os.Stdout)
+	flushLogWrites()
+	pendingWebhookWrites.Wait()
+	pendingHookRuns.Wait()
+	if err != nil {
+		if !errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+		}
+		return true, 1
+	}
+	return true, 0
+}
+
+// startHeadless loads the data files without a window.
+func startHeadless() {
+	headless = true
+	initData()
+}
+
+func newCLIFlagSet(name string) (*flag.FlagSet, *bool) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	asJSON := fs.Bool("json", false, "print JSON instead of text")
+	return fs, asJSON
+}
+
+// parseInterspersed parses flags that may come after positional arguments,
+// as in "lend ITEM --id ID", and returns the positional ones.
+func parseInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+	var pos []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		if fs.NArg() == 0 {
+			return pos, nil
+		}
+		pos = append(pos, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
+
+func writeJSON(out io.Writer, v any) error {
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// ---------- status / queue ----------
+
+type deviceView struct {
+	Device
+	Users []User `json:"users"`
+	// Event names the running event that holds the device.
+	Event string `json:"event,omitempty"`
+}
+
+type statusView struct {
+	Devices []deviceView `json:"devices"`
+	Queue   []User       `json:"queue"`
+}
+
+// buildStatusView must run holding the state lock (see withState).
+func buildStatusView() statusView {
+	v := statusView{Devices: []deviceView{}, Queue: getPendingUsers()}
+	now := time.Now()
+	for _, d := range allDevices {
+		dv := deviceView{Device: d, Users: usersOnDevice(d.ID)}
+		if t := reservationLocked(d.ID, now); t != nil {
+			dv.Event = t.Name
+		}
+		v.Devices = append(v.Devices, dv)
+	}
+	return v
+}
+
+func cliStatus(args []string, out io.Writer) error {
+	fs, asJSON := newCLIFlagSet("status")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	var (
+		v      statusView
+		active int
+	)
+	withState(func() {
+		v = buildStatusView()
+		active = len(activeUsers)
+	})
+	if *asJSON {
+		return writeJSON(out, v)
+	}
+	tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "DEVICE\tTYPE\tSTATUS\tUSERS")
+	for _, d := range v.Devices {
+		names := make([]string, 0, len(d.Users))
+		for _, u := range d.Users {
+			names = append(names, fmt.Sprintf("%s (%s, %s)", u.Name, u.ID, formatDuration(time.Since(u.CheckInTime))))
+		}
+		status := d.Status
+		if d.Event != "" {
+			status += " (" + d.Event + ")"
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", d.ID, d.Type, status, strings.Join(names, ", "))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "\nActive users: %d, queued: %d\n", active, len(v.Queue))
+	return nil
+}
+
+func cliQueue(args []string, out io.Writer) error {
+	fs, asJSON := newCLIFlagSet("queue")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	queue := snapshotState().pending()
+	if *asJSON {
+		return writeJSON(out, queue)
+	}
+	if len(queue) == 0 {
+		fmt.Fprintln(out, "Queue is empty.")
+		return nil
+	}
+	tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "#\tNAME\tID\tWAITING")
+	for i, u := range queue {
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", i+1, u.Name, u.ID, formatDuration(time.Since(u.CheckInTime)))
+	}
+	return tw.Flush()
+}
+
+// ---------- checkin / checkout ----------
+
+func cliCheckIn(args []string, out io.Writer) error {
+	fs, asJSON := newCLIFlagSet("checkin")
+	id := fs.String("id", "", "user ID (required)")
+	name := fs.String("name", "", "user name (defaults to the member record)")
+	device := fs.Int("device", 0, "device ID; 0 joins the queue")
+	game := fs.String("game", "", "game being played; must be installed on the device")
+	event := fs.String("event", "", "ID of the running event the user plays in")
+	afterHours := fs.Bool("after-hours", false, "check in even though the lounge is closed")
+	want := fs.String("want", "", "device type a queued user waits for (any if empty)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	uid := strings.TrimSpace(*id)
+	if uid == "" {
+		return fmt.Errorf("--id is required")
+	}
+	n, err := resolveMemberName(uid, *name)
+	if err != nil {
+		return err
+	}
+	if err := registerUserHours(n, uid, *device, strings.TrimSpace(*game), strings.TrimSpace(*event), *want, actorCLI, *afterHours); err != nil {
+		return err
+	}
+	u := snapshotState().user(uid)
+	if u == nil {
+		return fmt.Errorf("user ID %s not found after check-in", uid)
+	}
+	if *asJSON {
+		return writeJSON(out, u)
+	}
+	if u.PCID == 0 {
+		fmt.Fprintf(out, "Queued %s (%s).\n", u.Name, u.ID)
+	} else {
+		fmt.Fprintf(out, "Checked in %s (%s) on device %d.\n", u.Name, u.ID, u.PCID)
+	}
+	return nil
+}
+
+func cliGroup(args []string, out io.Writer) error {
+	fs, asJSON := newCLIFlagSet("group")
+	afterHours := fs.Bool("after-hours", false, "check in even though the lounge is closed")
+	pos, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	var group []Member
+	for _, arg := range pos {
+		id, name, _ := strings.Cut(arg, "=")
+		id = strings.TrimSpace(id)
+		n, err := resolveMemberName(id, name)
+		if err != nil {
+			return err
+		}
+		group = append(group, Member{ID: id, Name: n})
+	}
+	devices, err := checkInGroup(group, actorCLI, *afterHours)
+	if err != nil {
+		return err
+	}
+	snap := snapshotState()
+	users := make([]User, 0, len(group))
+	for _, m := range group {
+		if u := snap.user(m.ID); u != nil {
+			users = append(users, *u)
+		}
+	}
+	if *asJSON {
+		return writeJSON(out, users)
+	}
+	if devices == nil {
+		fmt.Fprintf(out, "No %d adjacent PCs are free; queued the group to be seated together.\n", len(group))
+		return nil
+	}
+	for _, u := range users {
+		fmt.Fprintf(out, "Checked in %s (%s) on device %d.\n", u.Name, u.ID, u.PCID)
+	}
+	return nil
+}
+
+func cliCheckOut(args []string, out io.Writer) error {
+	fs, asJSON := newCLIFlagSet("checkout")
+	id := fs.String("id", "", "user ID (required)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	uid := strings.TrimSpace(*id)
+	if uid == "" {
+		return fmt.Errorf("--id is required")
+	}
+	u := snapshotState().user(uid)
+	if u == nil {
+		return fmt.Errorf("user ID %s not found", uid)
+	}
+	user := *u
+	var loans []Loan
+	var err error
+	if user.PCID == 0 {
+		loans, err = removeQueuedUser(uid, actorCLI)
+	} else {
+		loans, err = checkoutUser(uid, actorCLI)
+	}
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		return writeJSON(out, struct {
+			User
+			Borrowed []Loan `json:"borrowed,omitempty"`
+		}{user, loans})
+	}
+	fmt.Fprintf(out, "Checked out %s (%s) after %s.\n", user.Name, user.ID, formatDuration(time.Since(user.CheckInTime)))
+	if len(loans) > 0 {
+		fmt.Fprintf(out, "Still borrowed: %s.\n", loanItemNames(loans))
+	}
+	return nil
+}
+
+func cliClose(args []string, out io.Writer) error {
+	fs, asJSON := newCLIFlagSet("close")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if !appConfig.Hours.Enabled {
+		return fmt.Errorf("opening hours are not configured")
+	}
+	closedAt := lastClosing(appConfig.Hours, time.Now())
+	if closedAt.IsZero() {
+		return fmt.Errorf("no closing time in the last week")
+	}
+	n, loans, err := closeLounge(closedAt)
+	if *asJSON {
+		if jerr := writeJSON(out, map[string]any{"closed_at": closedAt, "checked_out": n, "borrowed": loans}); jerr != nil {
+			return jerr
+		}
+	} else {
+		fmt.Fprintf(out, "Closing time %s: checked out %d user(s).\n", closedAt.Format("Mon 15:04"), n)
+		if len(loans) > 0 {
+			fmt.Fprintf(out, "Still borrowed: %s.\n", loansByUser(loans))
+		}
+	}
+	return err
+}
+
+func cliWake(args []string, out io.Writer) error {
+	fs, _ := newCLIFlagSet("wake")
+	all := fs.Bool("all", false, "wake every device with a MAC address")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	var ids []int
+	if *all {
+		ids = wakeableDevices()
+	}
+	for _, a := range fs.Args() {
+		id, err := strconv.Atoi(a)
+		if err != nil {
+			return fmt.Errorf("invalid device ID %q", a)
+		}
+		ids = append(ids, id)
+	}
+	if len(ids) == 0 {
+		return fmt.Errorf("give device IDs or --all")
+	}
+	if err := wakeDevices(ids, actorCLI); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Sent Wake-on-LAN to %d device(s).\n", len(ids))
+	return nil
+}
+
+// ---------- equipment ----------
+
+func cliEquipment(args []string, out io.Writer) error {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return cliEquipmentList(args, out)
+	}
+	switch args[0] {
+	case "add":
+		return cliEquipmentAdd(args[1:], out)
+	case "lend":
+		return cliEquipmentLend(args[1:], out)
+	case "return":
+		return cliEquipmentReturn(args[1:], out)
+	case "history":
+		return cliEquipmentHistory(args[1:], out)
+	}
+	return fmt.Errorf("equipment: unknown subcommand %q", args[0])
+}
+
+type equipmentView struct {
+	EquipmentItem
+	Loan *Loan `json:"loan,omitempty"`
+}
+
+func cliEquipmentList(args []string, out io.Writer) error {
+	fs, asJSON := newCLIFlagSet("equipment")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	d, err := loadEquipment()
+	if err != nil {
+		return err
+	}
+	views := []equipmentView{}
+	for _, it := range d.Items {
+		if !it.Retired {
+			views = append(views, equipmentView{EquipmentItem: it, Loan: d.openLoan(it.ID)})
+		}
+	}
+	if *asJSON {
+		return writeJSON(out, views)
+	}
+	tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tITEM\tKIND\tWITH")
+	for _, v := range views {
+		with := "-"
+		if v.Loan != nil {
+			with = fmt.Sprintf("%s (%s) since %s", v.Loan.UserName, v.Loan.UserID, v.Loan.Out.Format("15:04"))
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", v.ID, v.Name, orDash(v.Kind), with)
+	}
+	return tw.Flush()
+}
+
+func cliEquipmentAdd(args []string, out io.Writer) error {
+	fs, asJSON := newCLIFlagSet("equipment add")
+	kind := fs.String("kind", "", "kind of item, e.g. Controller")
+	pos, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(pos) != 1 {
+		return fmt.Errorf("equipment add: expected one item name")
+	}
+	item, err := addEquipmentItem(pos[0], *kind, actorCLI)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		return writeJSON(out, item)
+	}
+	fmt.Fprintf(out, "Added %s as item %s.\n", item.Name, item.ID)
+	return nil
+}
+
+func cliEquipmentLend(args []string, out io.Writer) error {
+	fs, _ := newCLIFlagSet("equipment lend")
+	id := fs.String("id", "", "user ID (required)")
+	pos, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(pos) != 1 || strings.TrimSpace(*id) == "" {
+		return fmt.Errorf("equipment lend: expected ITEM --id ID")
+	}
+	if err = lendEquipment(pos[0], strings.TrimSpace(*id), actorCLI); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Lent %s to %s.\n", pos[0], strings.TrimSpace(*id))
+	return nil
+}
+
+func cliEquipmentReturn(args []string, out io.Writer) error {
+	fs, _ := newCLIFlagSet("equipment return")
+	pos, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(pos) != 1 {
+		return fmt.Errorf("equipment return: expected one item")
+	}
+	if err = returnEquipment(pos[0], actorCLI); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Returned %s.\n", pos[0])
+	return nil
+}
+
+func cliEquipmentHistory(args []string, out io.Writer) error {
+	fs, asJSON := newCLIFlagSet("equipment history")
+	item := fs.String("item", "", "only this item (ID or name)")
+	id := fs.String("id", "", "only this user ID")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	d, err := loadEquipment()
+	if err != nil {
+		return err
+	}
+	itemID := ""
+	if *item != "" {
+		it := d.findItem(*item)
+		if it == nil {
+			return fmt.Errorf("no item %q", *item)
+		}
+		itemID = it.ID
+	}
+	loans := []Loan{}
+	for _, l := range d.Loans {
+		if (itemID == "" || l.ItemID == itemID) && (*id == "" || l.UserID == *id) {
+			loans = append(loans, l)
+		}
+	}
+	if *asJSON {
+		return writeJSON(out, loans)
+	}
+	tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "OUT\tRETURNED\tITEM\tUSER\tDEVICE")
+	for _, l := range loans {
+		back := "-"
+		if !l.isOut() {
+			back = l.Returned.Format("2006-01-02 15:04")
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s (%s)\t%d\n", l.Out.Format("2006-01-02 15:04"), back, l.ItemName, l.UserName, l.UserID, l.DeviceID)
+	}
+	return tw.Flush()
+}
+
+// ---------- events ----------
+
+func cliEvents(args []string, out io.Writer) error {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return cliEventsList(args, out)
+	}
+	switch args[0] {
+	case "add":
+		return cliEventsAdd(args[1:], out)
+	case "end":
+		return cliEventsEnd(args[1:], out)
+	}
+	return fmt.Errorf("events: unknown subcommand %q", args[0])
+}
+
+func cliEventsList(args []string, out io.Writer) error {
+	fs, asJSON := newCLIFlagSet("events")
+	all := fs.Bool("all", false, "include past events")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	now := time.Now()
+	list := []Tournament{}
+	for _, t := range snapshotState().Tournaments {
+		if *all || now.Before(t.End) {
+			list = append(list, t)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Start.Before(list[j].Start) })
+	if *asJSON {
+		return writeJSON(out, list)
+	}
+	tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tEVENT\tWHEN\tDEVICES\tSTATE")
+	for _, t := range list {
+		state := "upcoming"
+		switch {
+		case t.activeAt(now):
+			state = "running"
+		case !now.Before(t.End):
+			state = "over"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", t.ID, t.Name, t.window(), formatDeviceList(t.Devices), state)
+	}
+	return tw.Flush()
+}
+
+func cliEventsAdd(args []string, out io.Writer) error {
+	fs, asJSON := newCLIFlagSet("events add")
+	name := fs.String("name", "", "event name (required)")
+	date := fs.String("date", time.Now().Format("2006-01-02"), "day the event starts (YYYY-MM-DD)")
+	start := fs.String("start", "", "start time HH:MM (required)")
+	end := fs.String("end", "", "end time HH:MM; at or before the start means the next day (required)")
+	devices := fs.String("devices", "", `devices to hold, e.g. "1-8,17" (required)`)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	from, to, err := parseEventTimes(*date, *start, *end)
+	if err != nil {
+		return err
+	}
+	ids, err := parseDeviceList(*devices)
+	if err != nil {
+		return err
+	}
+	t, err := addTournament(Tournament{Name: *name, Devices: ids, Start: from, End: to}, actorCLI)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		return writeJSON(out, t)
+	}
+	fmt.Fprintf(out, "Added event %s: %s, %s, devices %s.\n", t.ID, t.Name, t.window(), formatDeviceList(t.Devices))
+	return nil
+}
+
+func cliEventsEnd(args []string, out io.Writer) error {
+	fs, _ := newCLIFlagSet("events end")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("events end: expected one event ID")
+	}
+	if err := endTournament(fs.Arg(0), actorCLI); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Released the devices of event %s.\n", fs.Arg(0))
+	return nil
+}
+
+// ---------- members ----------
+
+func cliMembers(args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return fmt.Errorf("members: expected import or export")
+	}
+	switch args[0] {
+	case "import":
+		return cliMembersImport(args[1:], out)
+	case "export":
+		return cliMembersExport(args[1:], out)
+	}
+	return fmt.Errorf("members: unknown subcommand %q", args[0])
+}
+
+func cliMembersImport(args []string, out io.Writer) error {
+	fs, asJSON := newCLIFlagSet("members import")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("members import: expected one CSV file")
+	}
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	incoming, err := parseMembersCSV(f)
+	if err != nil {
+		return fmt.Errorf("parse %s: %w", fs.Arg(0), err)
+	}
+	added, skipped := 0, 0
+	withState(func() {
+		for _, m := range incoming {
+			if memberByID(m.ID) != nil {
+				skipped++
+				continue
+			}
+			appendMember(m, actorCLI)
+			added++
+		}
+	})
+	if *asJSON {
+		return writeJSON(out, map[string]int{"added": added, "skipped": skipped})
+	}
+	fmt.Fprintf(out, "Imported %d members (%d already present).\n", added, skipped)
+	return nil
+}
+
+func cliMembersExport(args []string, out io.Writer) error {
+	fs, asJSON := newCLIFlagSet("members export")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 1 {
+		return fmt.Errorf("members export: expected at most one output file")
+	}
+	if fs.NArg() == 1 {
+		f, err := os.Create(fs.Arg(0))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+	members := snapshotMembers()
+	if *asJSON {
+		return writeJSON(out, members)
+	}
+	w := csv.NewWriter(out)
+	if err := w.Write([]string{"Name", "ID"}); err != nil {
+		return err
+	}
+	for _, m := range members {
+		if err := w.Write([]string{m.Name, m.ID}); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// ---------- report ----------
+
+type deviceUsage struct {
+	DeviceID int     `json:"device_id"`
+	Sessions int     `json:"sessions"`
+	Hours    float64 `json:"hours"`
+}
+
+type usageReport struct {
+	From         string        `json:"from"`
+	To           string        `json:"to"`
+	Sessions     int           `json:"sessions"`
+	OpenSessions int           `json:"open_sessions"`
+	UniqueUsers  int           `json:"unique_users"`
+	TotalHours   float64       `json:"total_hours"`
+	Devices      []deviceUsage `json:"devices"`
+	Games        []gameUsage   `json:"games"`
+	// EventHours is play checked in against events; the rest is casual.
+	EventHours  float64      `json:"event_hours"`
+	CasualHours float64      `json:"casual_hours"`
+	Events      []eventUsage `json:"events"`
+}
+
+// readLogEntriesBetween concatenates the daily logs for every day in
+// [from, to]; days without a log file are skipped.
+func readLogEntriesBetween(from, to time.Time) ([]LogEntry, error) {
+	all := []LogEntry{}
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		entries, err := readLogEntriesLocked(logFilePathForDate(day))
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, entries...)
+	}
+	return all, nil
+}
+
+func buildUsageReport(from, to time.Time, entries []LogEntry) usageReport {
+	rep := usageReport{From: from.Format("2006-01-02"), To: to.Format("2006-01-02"), Devices: []deviceUsage{}}
+	users := map[string]bool{}
+	byDevice := map[int]*deviceUsage{}
+	for _, e := range entries {
+		if e.PCID == 0 {
+			continue // queue entries that never reached a device
+		}
+		rep.Sessions++
+		users[e.UserID] = true
+		if e.CheckOutTime.IsZero() {
+			rep.OpenSessions++
+			continue
+		}
+		rep.TotalHours += e.CheckOutTime.Sub(e.CheckInTime).Hours()
+		counted := map[int]bool{}
+		for _, s := range e.segments() {
+			du := byDevice[s.PCID]
+			if du == nil {
+				du = &deviceUsage{DeviceID: s.PCID}
+				byDevice[s.PCID] = du
+			}
+			if !counted[s.PCID] {
+				counted[s.PCID] = true
+				du.Sessions++
+			}
+			du.Hours += s.hours()
+		}
+	}
+	rep.UniqueUsers = len(users)
+	for _, du := range byDevice {
+		rep.Devices = append(rep.Devices, *du)
+	}
+	sort.Slice(rep.Devices, func(i, j int) bool { return rep.Devices[i].DeviceID < rep.Devices[j].DeviceID })
+	rep.Games = gameUsageFor(entries)
+	rep.Events, rep.EventHours = eventUsageFor(entries, snapshotState().Tournaments)
+	rep.CasualHours = rep.TotalHours - rep.EventHours
+	return rep
+}
+
+func cliReport(args []string, out io.Writer) error {
+	fs, asJSON := newCLIFlagSet("report")
+	today := time.Now().Format("2006-01-02")
+	fromText := fs.String("from", today, "first day (YYYY-MM-DD)")
+	toText := fs.String("to", today, "last day (YYYY-MM-DD)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	from, err := time.ParseInLocation("2006-01-02", *fromText, time.Local)
+	if err != nil {
+		return fmt.Errorf("invalid --from: %w", err)
+	}
+	to, err := time.ParseInLocation("2006-01-02", *toText, time.Local)
+	if err != nil {
+		return fmt.Errorf("invalid --to: %w", err)
+	}
+	if to.Before(from) {
+		return fmt.Errorf("--to is before --from")
+	}
+	entries, err := readLogEntriesBetween(from, to)
+	if err != nil {
+		return err
+	}
+	rep := buildUsageReport(from, to, entries)
+	if *asJSON {
+		return writeJSON(out, rep)
+	}
+	fmt.Fprintf(out, "Report %s to %s\n", rep.From, rep.To)
+	fmt.Fprintf(out, "Sessions: %d (%d still open), unique users: %d, total: %.1fh\n\n",
+		rep.Sessions, rep.OpenSessions, rep.UniqueUsers, rep.TotalHours)
+	if len(rep.Events) > 0 {
+		fmt.Fprintf(out, "Casual: %.1fh, events: %.1fh\n\n", rep.CasualHours, rep.EventHours)
+	}
+	tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "DEVICE\tSESSIONS\tHOURS")
+	for _, du := range rep.Devices {
+		fmt.Fprintf(tw, "%d\t%d\t%.1f\n", du.DeviceID, du.Sessions, du.Hours)
+	}
+	if len(rep.Events) > 0 {
+		fmt.Fprintln(tw, "\nEVENT\tSESSIONS\tHOURS")
+		for _, eu := range rep.Events {
+			fmt.Fprintf(tw, "%s\t%d\t%.1f\n", eu.Name, eu.Sessions, eu.Hours)
+		}
+	}
+	if len(rep.Games) > 0 {
+		fmt.Fprintln(tw, "\nGAME\tSESSIONS\tHOURS")
+		for _, gu := range rep.Games {
+			fmt.Fprintf(tw, "%s\t%d\t%.1f\n", gu.Game, gu.Sessions, gu.Hours)
+		}
+	}
+	return tw.Flush()
+}
+
+// ---------- serve ----------
+
+func cliServe(args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	addr := fs.String("addr", appConfig.API.Addr, "listen address")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	cfg := appConfig.API
+	cfg.Addr = *addr
+	if _, err := startAPIServer(cfg); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Serving lounge API on %s\n", cfg.Addr)
+	// Like the window, only the process holding the instance lock sends
+	// webhooks, drives the PC agents and seats queued groups; the lock is
+	// retried on every tick in case the holder exits.
+	startPrimary := func() {
+		if acquireInstanceLock(); instanceLock != nil {
+			startWebhookSender()
+			startAgents()
+			startGroupSeating()
+		}
+	}
+	startPrimary()
+	if instanceLock == nil {
+		fmt.Fprintf(out, "%s holds this data folder; background jobs run there.\n", otherInstance)
+	}
+	for range time.Tick(dataSyncInterval) {
+		startPrimary()
+		withState(func() {
+			if changed, _ := syncFromDisk(); changed {
+				publishEvent(LoungeEvent{Type: EventReload})
+			}
+		})
+	}
+	return nil
+}
+
+// ---------- audit ----------
+
+func cliAudit(args []string, out io.Writer) error {
+	if len(args) > 0 && args[0] == "verify" {
+		recs, err := readAuditRecords()
+		if err != nil {
+			return err
+		}
+		if i, why := verifyAuditChain(recs); i >= 0 {
+			return errors.New(why)
+		}
+		fmt.Fprintln(out, auditChainSummary(recs))
+		return nil
+	}
+
+	fs, asJSON := newCLIFlagSet("audit")
+	actor := fs.String("actor", "", "only records by this staff ID or actor")
+	action := fs.String("action", "", "only records with this action")
+	limit := fs.Int("limit", 50, "show at most this many records (0 = all)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	recs, err := readAuditRecords()
+	if err != nil {
+		return err
+	}
+	shown := []AuditRecord{}
+	for _, r := range recs {
+		if (*actor == "" || r.Actor == *actor) && (*action == "" || r.Action == *action) {
+			shown = append(shown, r)
+		}
+	}
+	if *limit > 0 && len(shown) > *limit {
+		shown = shown[len(shown)-*limit:]
+	}
+	if *asJSON {
+		return writeJSON(out, shown)
+	}
+	tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "#\tTIME\tACTOR\tACTION\tTARGET\tRESULT")
+	for _, r := range shown {
+		result := "ok"
+		if !r.OK {
+			result = "failed: " + r.Error
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\n", r.Seq, r.Time.Format("2006-01-02 15:04:05"), r.Actor, r.Action, r.Target, result)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,134 @@
+// Command lounge-agent runs on a lounge PC and locks or unlocks it when the
+// lounge app says so. Locking is done by running the configured commands, so
+// the agent works with whatever lock screen the PC uses.
+//
+//	lounge-agent -device 3 -token SECRET \
+//	    -lock-cmd "loginctl lock-sessions" -unlock-cmd "loginctl unlock-sessions" \
+//	    -report-cmd "/usr/local/bin/lounge-activity" -shutdown-cmd "systemctl poweroff"
+//
+// The report command prints a JSON object such as
+// {"user": "gamer", "idle_seconds": 42, "game": "Rocket League"}.
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"runtime"
+	"time"
+
+	"lounge/agent"
+)
+
+// A reply runs the command and then the activity report, so together they
+// stay under agent.CallTimeout. Otherwise the lounge gives up while the PC is
+// still locking or unlocking and shows the wrong state.
+const (
+	commandTimeout = 5 * time.Second
+	reportTimeout  = 3 * time.Second
+)
+
+type commandHandler struct {
+	lockCmd, unlockCmd, reportCmd, shutdownCmd string
+}
+
+func (h commandHandler) Lock() error { return runShell(h.lockCmd, nil) }
+
+func (h commandHandler) Unlock(userID, userName string) error {
+	return runShell(h.unlockCmd, []string{"LOUNGE_USER_ID=" + userID, "LOUNGE_USER_NAME=" + userName})
+}
+
+func (h commandHandler) Shutdown() error {
+	if h.shutdownCmd == "" {
+		return fmt.Errorf("no -shutdown-cmd configured")
+	}
+	return runShell(h.shutdownCmd, nil)
+}
+
+func (h commandHandler) Activity() (*agent.Activity, error) {
+	if h.reportCmd == "" {
+		return nil, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), reportTimeout)
+	defer cancel()
+	out, err := shellCommand(ctx, h.reportCmd).Output()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", h.reportCmd, err)
+	}
+	var a agent.Activity
+	if err := json.Unmarshal(out, &a); err != nil {
+		return nil, fmt.Errorf("%s: %v", h.reportCmd, err)
+	}
+	return &a, nil
+}
+
+// runShell runs line with the system shell; an empty line does nothing.
+func runShell(line string, env []string) error {
+	if line == "" {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+	cmd := shellCommand(ctx, line)
+	cmd.Env = append(os.Environ(), env...)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s: %v: %s", line, err, out)
+	}
+	return nil
+}
+
+func shellCommand(ctx context.Context, line string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.CommandContext(ctx, "cmd", "/C", line)
+	}
+	return exec.CommandContext(ctx, "sh", "-c", line)
+}
+
+func main() {
+	listen := flag.String("listen", fmt.Sprintf(":%d", agent.DefaultPort), "listen address")
+	device := flag.Int("device", 0, "lounge device ID of this PC (0 accepts any)")
+	token := flag.String("token", os.Getenv("LOUNGE_AGENT_TOKEN"), "shared token (default $LOUNGE_AGENT_TOKEN)")
+	certFile := flag.String("cert", "", "TLS certificate; TLS is off without one")
+	keyFile := flag.String("key", "", "TLS key")
+	lockCmd := flag.String("lock-cmd", "", "command that locks the PC")
+	unlockCmd := flag.String("unlock-cmd", "", "command that unlocks the PC; gets $LOUNGE_USER_ID and $LOUNGE_USER_NAME")
+	reportCmd := flag.String("report-cmd", "", "command printing the PC's activity as JSON (user, idle_seconds, game)")
+	shutdownCmd := flag.String("shutdown-cmd", "", "command that powers the PC off")
+	lockAtStart := flag.Bool("lock-at-start", true, "lock the PC when the agent starts")
+	flag.Parse()
+
+	if *token == "" {
+		log.Fatal("a token is required (-token or $LOUNGE_AGENT_TOKEN)")
+	}
+	h := commandHandler{lockCmd: *lockCmd, unlockCmd: *unlockCmd, reportCmd: *reportCmd, shutdownCmd: *shutdownCmd}
+	srv := agent.NewServer(*token, *device, h)
+	srv.Logf = log.Printf
+	if *lockAtStart {
+		if err := h.Lock(); err != nil {
+			log.Printf("lock at start: %v", err)
+		}
+	} else {
+		srv.SetLocked(false)
+	}
+
+	ln, err := net.Listen("tcp", *listen)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *certFile != "" {
+		cert, err := tls.LoadX509KeyPair(*certFile, *keyFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		ln = tls.NewListener(ln, &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12})
+	}
+	log.Printf("lounge agent for device %d listening on %s", *device, ln.Addr())
+	log.Fatal(srv.Serve(ln))
+}
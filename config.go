@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ---------- Settings file ----------
+
+const configFile = "log/config.json"
+
+type Config struct {
+	API      APIConfig       `json:"api"`
+	Board    BoardConfig     `json:"board"`
+	Kiosk    KioskConfig     `json:"kiosk"`
+	Hours    HoursConfig     `json:"hours"`
+	Rules    []AlertRule     `json:"rules"`
+	Webhooks []WebhookConfig `json:"webhooks"`
+	// Hooks maps on_<event type> to a program to run; see hooks.go.
+	Hooks  map[string]HookConfig `json:"hooks"`
+	Agents AgentsConfig          `json:"agents"`
+	// Devices holds per-device settings keyed by device ID.
+	Devices map[string]DeviceConfig `json:"devices"`
+}
+
+type APIConfig struct {
+	Enabled bool   `json:"enabled"`
+	Addr    string `json:"addr"`
+	Token   string `json:"token"`
+}
+
+type BoardConfig struct {
+	// ShowNames puts first/last names under busy devices; off by default so
+	// the public board carries no personal data.
+	ShowNames bool `json:"show_names"`
+	// Web serves the board at /board on the API server without a token.
+	Web bool `json:"web"`
+}
+
+type KioskConfig struct {
+	// PIN leaves kiosk mode while there are no staff accounts; kiosk mode will
+	// not start without one then. Once staff exist they exit with their own PIN.
+	PIN string `json:"pin"`
+}
+
+var appConfig = defaultConfig()
+
+func defaultConfig() Config {
+	return Config{
+		API:   APIConfig{Addr: "127.0.0.1:8787"},
+		Hours: HoursConfig{Open: "10:00", Close: "23:00", WarnMinutes: 15},
+	}
+}
+
+// loadConfig reads log/config.json over the defaults. A missing file is not
+// an error; everything optional stays switched off.
+func loadConfig() error {
+	appConfig = defaultConfig()
+	b, err := os.ReadFile(configFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("read config: %w", err)
+	}
+	if len(b) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(b, &appConfig); err != nil {
+		return fmt.Errorf("unmarshal config: %s: %w", configFile, err)
+	}
+	for i, r := range appConfig.Rules {
+		if strings.TrimSpace(r.Name) == "" {
+			appConfig.Rules[i].Name = fmt.Sprintf("Rule %d", i+1)
+		}
+	}
+	if err := validateHours(appConfig.Hours); err != nil {
+		appConfig.Hours.Enabled = false
+		return fmt.Errorf("%s: %w; opening hours are disabled", configFile, err)
+	}
+	return nil
+}
@@ -0,0 +1,368 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+)
+
+// ---------- Multi-instance safety ----------
+//
+// Several front-desk machines may share log/ on a network drive. Every read
+// and write of the shared files happens under an advisory lock on
+// log/.lounge.lock, active_users.json is merged with what is on disk before
+// each write, and the window polls for changes made by other instances.
+
+const (
+	dataLockFile     = "log/.lounge.lock"
+	instanceLockFile = "log/.instance.lock"
+	instanceInfoFile = "log/instance.json"
+
+	dataSyncInterval = 5 * time.Second
+)
+
+var errLockHeld = errors.New("lock held by another process")
+
+var (
+	dataLockMutex sync.Mutex
+
+	// userDataBase is activeUsers as last read from or written to disk, the
+	// common ancestor for merging another instance's changes.
+	userDataBase []User
+	userDataSum  [sha256.Size]byte
+
+	dailyLogStamp string // guarded by dataLockMutex
+
+	instanceLock  *os.File
+	otherInstance string // set while another process holds the instance lock
+)
+
+type instanceInfo struct {
+	Host    string    `json:"host"`
+	PID     int       `json:"pid"`
+	Started time.Time `json:"started"`
+}
+
+// withDataLock runs fn holding the shared data lock. Calls must not nest.
+func withDataLock(fn func() error) error {
+	dataLockMutex.Lock()
+	defer dataLockMutex.Unlock()
+	if err := ensureLogDir(); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(dataLockFile, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return fmt.Errorf("open lock: %w", err)
+	}
+	defer f.Close()
+	if err := lockFile(f); err != nil {
+		return fmt.Errorf("lock %s: %w", dataLockFile, err)
+	}
+	defer unlockFile(f)
+	return fn()
+}
+
+func readLogEntriesLocked(p string) ([]LogEntry, error) {
+	var entries []LogEntry
+	err := withDataLock(func() error {
+		var err error
+		entries, err = readLogEntriesFile(p)
+		return err
+	})
+	return entries, err
+}
+
+// ---------- active_users.json ----------
+
+func readUserDataFile() ([]User, [sha256.Size]byte, error) {
+	var sum [sha256.Size]byte
+	b, err := os.ReadFile(userDataFile)
+	if os.IsNotExist(err) {
+		return []User{}, sum, nil
+	}
+	if err != nil {
+		return nil, sum, err
+	}
+	sum = sha256.Sum256(b)
+	users := []User{}
+	if len(bytes.TrimSpace(b)) > 0 {
+		if err := json.Unmarshal(b, &users); err != nil {
+			return nil, sum, fmt.Errorf("unmarshal %s: %w", userDataFile, err)
+		}
+	}
+	return users, sum, nil
+}
+
+func rememberUserData(users []User, sum [sha256.Size]byte) {
+	userDataBase = append([]User{}, users...)
+	userDataSum = sum
+}
+
+// loadUserData replaces activeUsers with the file contents. Call under
+// withDataLock.
+func loadUserData() error {
+	users, sum, err := readUserDataFile()
+	if err != nil {
+		activeUsers = []User{}
+		rememberUserData(activeUsers, sum)
+		return err
+	}
+	activeUsers = users
+	rememberUserData(users, sum)
+	rebuildDeviceStatus()
+	return nil
+}
+
+// writeUserData merges any outside changes, then writes activeUsers. Call
+// under withDataLock.
+func writeUserData() error {
+	if _, err := mergeUserDataFromDisk(); err != nil {
+		return err
+	}
+	data, err := json.Marshal(activeUsers)
+	if err != nil {
+		return fmt.Errorf("marshal user data: %w", err)
+	}
+	data = append(data, '\n')
+	if err := os.WriteFile(userDataFile, data, 0o644); err != nil {
+		return err
+	}
+	rememberUserData(activeUsers, sha256.Sum256(data))
+	return nil
+}
+
+// mergeUserDataFromDisk folds in active_users.json if another process has
+// changed it since we last synced. Call under withDataLock.
+func mergeUserDataFromDisk() (changed bool, err error) {
+	disk, sum, err := readUserDataFile()
+	if err != nil {
+		return false, err
+	}
+	if sum == userDataSum {
+		return false, nil
+	}
+	merged := mergeUsers(userDataBase, activeUsers, disk)
+	conflicts := resolveDeviceConflicts(merged)
+	activeUsers = merged
+	rememberUserData(disk, sum)
+	rebuildDeviceStatus()
+	if len(conflicts) > 0 {
+		reportSyncConflicts(conflicts)
+	}
+	return true, nil
+}
+
+func sameUser(a, b User) bool {
+	ja, _ := json.Marshal(a)
+	jb, _ := json.Marshal(b)
+	return bytes.Equal(ja, jb)
+}
+
+func sameUsers(a, b []User) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !sameUser(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// mergeUsers three-way merges the active user lists: base is what this
+// process last synced with disk, ours is in memory and theirs is on disk now.
+// A change on either side wins over base; when both changed a user, ours wins.
+func mergeUsers(base, ours, theirs []User) []User {
+	index := func(list []User) map[string]User {
+		m := make(map[string]User, len(list))
+		for _, u := range list {
+			m[u.ID] = u
+		}
+		return m
+	}
+	baseByID, oursByID, theirsByID := index(base), index(ours), index(theirs)
+
+	merged := []User{}
+	for _, o := range ours {
+		b, inBase := baseByID[o.ID]
+		t, inTheirs := theirsByID[o.ID]
+		switch {
+		case !inBase:
+			merged = append(merged, o) // added here
+		case !inTheirs:
+			if !sameUser(o, b) {
+				merged = append(merged, o) // changed here, removed there
+			}
+		case sameUser(o, b):
+			merged = append(merged, t)
+		default:
+			merged = append(merged, o)
+		}
+	}
+	for _, t := range theirs {
+		if _, inOurs := oursByID[t.ID]; inOurs {
+			continue
+		}
+		if _, inBase := baseByID[t.ID]; !inBase {
+			merged = append(merged, t) // added there
+		}
+	}
+	return merged
+}
+
+// resolveDeviceConflicts keeps the earliest check-in when two instances put
+// different users on the same PC and sends the others back to the queue.
+func resolveDeviceConflicts(users []User) []string {
+	byPC := map[int][]int{}
+	for i, u := range users {
+		if d := getDeviceByID(u.PCID); d != nil && d.Type == "PC" {
+			byPC[u.PCID] = append(byPC[u.PCID], i)
+		}
+	}
+	conflicts := []string{}
+	for pc, idx := range byPC {
+		if len(idx) < 2 {
+			continue
+		}
+		sort.Slice(idx, func(a, b int) bool { return users[idx[a]].CheckInTime.Before(users[idx[b]].CheckInTime) })
+		for _, i := range idx[1:] {
+			conflicts = append(conflicts, fmt.Sprintf("%s (%s) was also checked in on PC %d by another desk and has been moved back to the queue",
+				users[i].Name, users[i].ID, pc))
+			users[i].PCID = 0
+		}
+	}
+	return conflicts
+}
+
+func reportSyncConflicts(conflicts []string) {
+	for _, c := range conflicts {
+		fmt.Println("Sync conflict:", c)
+	}
+	if headless || mainWindow == nil {
+		return
+	}
+	// Merges run under the state lock on any goroutine; show the dialog later.
+	fyne.Do(func() {
+		dialog.ShowInformation("Changes From Another Desk", strings.Join(conflicts, "\n"), mainWindow)
+	})
+}
+
+// rebuildDeviceStatus derives device occupancy from activeUsers.
+func rebuildDeviceStatus() {
+	for j := range allDevices {
+		allDevices[j].Status = "free"
+		allDevices[j].UserID = ""
+	}
+	for i := range activeUsers {
+		u := &activeUsers[i]
+		for j := range allDevices {
+			if allDevices[j].ID == u.PCID {
+				allDevices[j].Status = "occupied"
+				if allDevices[j].Type == "PC" {
+					allDevices[j].UserID = u.ID
+				}
+				break
+			}
+		}
+	}
+}
+
+// ---------- Change detection ----------
+
+func fileStamp(p string) string {
+	fi, err := os.Stat(p)
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("%d/%d", fi.ModTime().UnixNano(), fi.Size())
+}
+
+// syncFromDisk picks up changes other instances made to the active users and
+// today's log. Call holding the state lock (see withState).
+func syncFromDisk() (usersChanged, logChanged bool) {
+	err := withDataLock(func() error {
+		changed, err := mergeUserDataFromDisk()
+		if err != nil || !changed {
+			return err
+		}
+		usersChanged = true
+		if !sameUsers(userDataBase, activeUsers) {
+			return writeUserData() // our side of the merge is not on disk yet
+		}
+		return nil
+	})
+	if err != nil {
+		fmt.Println("Error syncing user data:", err)
+	}
+
+	// New or ended events change the same views as new users do.
+	if changed, err := loadTournaments(); err != nil {
+		fmt.Println("Error syncing events:", err)
+	} else if changed {
+		usersChanged = true
+	}
+
+	_ = withDataLock(func() error {
+		if stamp := fileStamp(getLogFilePath()); stamp != dailyLogStamp {
+			dailyLogStamp = stamp
+			logChanged = true
+		}
+		return nil
+	})
+	return usersChanged, logChanged
+}
+
+// ---------- Instance lock ----------
+
+// acquireInstanceLock tries to become the primary instance for this data
+// folder; on failure otherInstance describes the holder for the banner.
+func acquireInstanceLock() {
+	if instanceLock != nil {
+		return
+	}
+	if err := ensureLogDir(); err != nil {
+		return
+	}
+	f, err := os.OpenFile(instanceLockFile, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		fmt.Println("Error opening instance lock:", err)
+		return
+	}
+	if err := tryLockFile(f); err != nil {
+		f.Close()
+		otherInstance = describeOtherInstance()
+		return
+	}
+	instanceLock = f
+	otherInstance = ""
+	host, _ := os.Hostname()
+	info, _ := json.MarshalIndent(instanceInfo{Host: host, PID: os.Getpid(), Started: time.Now()}, "", "  ")
+	_ = os.WriteFile(instanceInfoFile, info, 0o644)
+}
+
+func describeOtherInstance() string {
+	b, err := os.ReadFile(instanceInfoFile)
+	var info instanceInfo
+	if err != nil || json.Unmarshal(b, &info) != nil {
+		return "another instance"
+	}
+	return fmt.Sprintf("%s (pid %d, since %s)", info.Host, info.PID, info.Started.Format("15:04 Jan 02"))
+}
+
+func instanceWarning() string {
+	if otherInstance == "" {
+		return ""
+	}
+	return fmt.Sprintf("Another Lounge window is using this data folder: %s. Changes are merged every few seconds; double-check before assigning devices.", otherInstance)
+}
@@ -0,0 +1,502 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/layout"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+)
+
+// ---------- Equipment lending ----------
+//
+// Controllers, headsets, wheels and the like are lent to users who are
+// checked in. The inventory and every loan, returned or not, are kept in
+// log/equipment.json; each change rereads and rewrites it under the data lock
+// so desks sharing the folder see one list.
+
+const equipmentFile = "log/equipment.json"
+
+const (
+	auditEquipmentAdd    = "equipment_add"
+	auditEquipmentRetire = "equipment_retire"
+	auditEquipmentLend   = "equipment_lend"
+	auditEquipmentReturn = "equipment_return"
+)
+
+type EquipmentItem struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Kind string `json:"kind,omitempty"`
+	// Retired items stay in the history but can no longer be lent.
+	Retired bool `json:"retired,omitempty"`
+}
+
+// Loan is one lending of an item to a user's session; it is out until
+// Returned is set.
+type Loan struct {
+	ItemID       string    `json:"item_id"`
+	ItemName     string    `json:"item_name"`
+	UserID       string    `json:"user_id"`
+	UserName     string    `json:"user_name"`
+	DeviceID     int       `json:"device_id,omitempty"`
+	SessionStart time.Time `json:"session_start"`
+	Out          time.Time `json:"out"`
+	OutBy        string    `json:"out_by,omitempty"`
+	Returned     time.Time `json:"returned,omitempty"`
+	ReturnedBy   string    `json:"returned_by,omitempty"`
+}
+
+func (l Loan) isOut() bool { return l.Returned.IsZero() }
+
+type equipmentData struct {
+	Items []EquipmentItem `json:"items"`
+	Loans []Loan          `json:"loans"`
+}
+
+// findItem matches an item by ID, or by name ignoring case.
+func (d *equipmentData) findItem(key string) *EquipmentItem {
+	key = strings.TrimSpace(key)
+	for i := range d.Items {
+		if d.Items[i].ID == key {
+			return &d.Items[i]
+		}
+	}
+	for i := range d.Items {
+		if !d.Items[i].Retired && strings.EqualFold(d.Items[i].Name, key) {
+			return &d.Items[i]
+		}
+	}
+	return nil
+}
+
+func (d *equipmentData) openLoan(itemID string) *Loan {
+	for i := len(d.Loans) - 1; i >= 0; i-- {
+		if d.Loans[i].ItemID == itemID && d.Loans[i].isOut() {
+			return &d.Loans[i]
+		}
+	}
+	return nil
+}
+
+func (d *equipmentData) nextItemID() string {
+	max := 0
+	for _, it := range d.Items {
+		if n, err := strconv.Atoi(it.ID); err == nil && n > max {
+			max = n
+		}
+	}
+	return strconv.Itoa(max + 1)
+}
+
+// readEquipmentFile must run holding the data lock.
+func readEquipmentFile() (equipmentData, error) {
+	var d equipmentData
+	b, err := os.ReadFile(equipmentFile)
+	if os.IsNotExist(err) || (err == nil && len(b) == 0) {
+		return d, nil
+	}
+	if err != nil {
+		return d, fmt.Errorf("read equipment: %w", err)
+	}
+	if err := json.Unmarshal(b, &d); err != nil {
+		return d, fmt.Errorf("unmarshal %s: %w", equipmentFile, err)
+	}
+	return d, nil
+}
+
+func writeEquipmentFile(d equipmentData) error {
+	data, err := json.MarshalIndent(d, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal equipment: %w", err)
+	}
+	tmp := equipmentFile + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, equipmentFile)
+}
+
+func loadEquipment() (equipmentData, error) {
+	var d equipmentData
+	err := withDataLock(func() error {
+		var err error
+		d, err = readEquipmentFile()
+		return err
+	})
+	return d, err
+}
+
+// updateEquipment applies fn to the file's current contents and saves them
+// unless fn fails.
+func updateEquipment(fn func(d *equipmentData) error) error {
+	return withDataLock(func() error {
+		d, err := readEquipmentFile()
+		if err != nil {
+			return err
+		}
+		if err := fn(&d); err != nil {
+			return err
+		}
+		return writeEquipmentFile(d)
+	})
+}
+
+func addEquipmentItem(name, kind, by string) (item EquipmentItem, err error) {
+	item = EquipmentItem{Name: strings.TrimSpace(name), Kind: strings.TrimSpace(kind)}
+	if item.Name == "" {
+		return item, fmt.Errorf("an item name is required")
+	}
+	err = updateEquipment(func(d *equipmentData) error {
+		if d.findItem(item.Name) != nil {
+			return fmt.Errorf("there is already an item called %q", item.Name)
+		}
+		item.ID = d.nextItemID()
+		d.Items = append(d.Items, item)
+		return nil
+	})
+	recordAudit(by, auditEquipmentAdd, item.ID, nil, item, err)
+	return item, err
+}
+
+func retireEquipmentItem(key, by string) (err error) {
+	var item EquipmentItem
+	err = updateEquipment(func(d *equipmentData) error {
+		it := d.findItem(key)
+		if it == nil {
+			return fmt.Errorf("no item %q", key)
+		}
+		if l := d.openLoan(it.ID); l != nil {
+			return fmt.Errorf("%s is still lent to %s", it.Name, l.UserName)
+		}
+		it.Retired = true
+		item = *it
+		return nil
+	})
+	recordAudit(by, auditEquipmentRetire, key, nil, item, err)
+	return err
+}
+
+// lendEquipment lends an item to a user who is checked in or queued.
+func lendEquipment(key, userID, by string) (err error) {
+	u := snapshotState().user(userID)
+	if u == nil {
+		return fmt.Errorf("user ID %s is not checked in", userID)
+	}
+	loan := Loan{UserID: u.ID, UserName: u.Name, DeviceID: u.PCID, SessionStart: u.CheckInTime, Out: time.Now(), OutBy: by}
+	err = updateEquipment(func(d *equipmentData) error {
+		it := d.findItem(key)
+		if it == nil || it.Retired {
+			return fmt.Errorf("no item %q", key)
+		}
+		if l := d.openLoan(it.ID); l != nil {
+			return fmt.Errorf("%s is already lent to %s", it.Name, l.UserName)
+		}
+		loan.ItemID, loan.ItemName = it.ID, it.Name
+		d.Loans = append(d.Loans, loan)
+		return nil
+	})
+	recordAudit(by, auditEquipmentLend, key, nil, loan, err)
+	return err
+}
+
+func returnEquipment(key, by string) (err error) {
+	var loan Loan
+	err = updateEquipment(func(d *equipmentData) error {
+		it := d.findItem(key)
+		if it == nil {
+			return fmt.Errorf("no item %q", key)
+		}
+		l := d.openLoan(it.ID)
+		if l == nil {
+			return fmt.Errorf("%s is not lent out", it.Name)
+		}
+		l.Returned = time.Now()
+		l.ReturnedBy = by
+		loan = *l
+		return nil
+	})
+	recordAudit(by, auditEquipmentReturn, key, nil, loan, err)
+	return err
+}
+
+// loansOutTo lists what a user still has. checkoutUser returns it, so front
+// ends use that rather than calling this themselves.
+func loansOutTo(userID string) []Loan {
+	d, err := loadEquipment()
+	if err != nil {
+		fmt.Println("Error loading equipment:", err)
+		return nil
+	}
+	var out []Loan
+	for _, l := range d.Loans {
+		if l.UserID == userID && l.isOut() {
+			out = append(out, l)
+		}
+	}
+	return out
+}
+
+// borrowedNote is the reminder published with a checkout, or "" when the
+// user returned everything.
+func borrowedNote(loans []Loan) string {
+	if len(loans) == 0 {
+		return ""
+	}
+	return "still borrowed: " + loanItemNames(loans)
+}
+
+func loanItemNames(loans []Loan) string {
+	names := make([]string, len(loans))
+	for i, l := range loans {
+		names[i] = l.ItemName
+	}
+	return strings.Join(names, ", ")
+}
+
+// ---------- Equipment dialogs ----------
+
+// checkoutWithEquipment checks a user out from the staff window. If they
+// still have borrowed items it asks first and offers to take them back.
+func checkoutWithEquipment(userID string) {
+	checkout := func() {
+		if _, err := checkoutUser(userID, actingStaff()); err != nil {
+			dialog.ShowError(err, mainWindow)
+		}
+	}
+	loans := loansOutTo(userID)
+	if len(loans) == 0 {
+		checkout()
+		return
+	}
+	var lines []string
+	for _, l := range loans {
+		lines = append(lines, "  • "+l.ItemName)
+	}
+	msg := widget.NewLabel(fmt.Sprintf("%s still has:\n%s", loans[0].UserName, strings.Join(lines, "\n")))
+
+	var dlg *dialog.CustomDialog
+	returnAll := widget.NewButtonWithIcon("Return All & Check Out", theme.ConfirmIcon(), func() {
+		dlg.Hide()
+		for _, l := range loans {
+			if err := returnEquipment(l.ItemID, actingStaff()); err != nil {
+				dialog.ShowError(err, mainWindow)
+				return
+			}
+		}
+		checkout()
+	})
+	returnAll.Importance = widget.HighImportance
+	anyway := widget.NewButton("Check Out Anyway", func() {
+		dlg.Hide()
+		checkout()
+	})
+	cancel := widget.NewButton("Cancel", func() { dlg.Hide() })
+	dlg = dialog.NewCustomWithoutButtons("Borrowed Equipment", container.NewVBox(msg, container.NewHBox(cancel, anyway, returnAll)), mainWindow)
+	dlg.Show()
+}
+
+// equipmentStatus describes where an item is; stale is set for loans whose
+// session has ended.
+func equipmentStatus(d *equipmentData, snap stateSnapshot, it EquipmentItem) (text string, stale bool) {
+	l := d.openLoan(it.ID)
+	if l == nil {
+		return "in", false
+	}
+	text = fmt.Sprintf("out to %s (%s) since %s", l.UserName, l.UserID, l.Out.Format("15:04"))
+	if u := snap.user(l.UserID); u == nil || !u.CheckInTime.Equal(l.SessionStart) {
+		return text + " - session ended", true
+	}
+	return text, false
+}
+
+func showEquipmentDialog() {
+	var data equipmentData
+	var items []EquipmentItem
+	var selected = -1
+	var list *widget.List
+
+	reload := func() {
+		d, err := loadEquipment()
+		if err != nil {
+			dialog.ShowError(err, mainWindow)
+			return
+		}
+		data = d
+		items = items[:0]
+		for _, it := range d.Items {
+			if !it.Retired {
+				items = append(items, it)
+			}
+		}
+		selected = -1
+		if list != nil {
+			list.UnselectAll()
+			list.Refresh()
+		}
+	}
+	reload()
+	snap := snapshotState()
+
+	list = widget.NewList(
+		func() int { return len(items) },
+		func() fyne.CanvasObject { return widget.NewLabel("") },
+		func(i widget.ListItemID, o fyne.CanvasObject) {
+			it := items[i]
+			status, stale := equipmentStatus(&data, snap, it)
+			l := o.(*widget.Label)
+			name := it.Name
+			if it.Kind != "" {
+				name += " [" + it.Kind + "]"
+			}
+			l.SetText(fmt.Sprintf("%s: %s", name, status))
+			l.Importance = widget.MediumImportance
+			if stale {
+				l.Importance = widget.DangerImportance
+			}
+			l.Refresh()
+		})
+	list.OnSelected = func(i widget.ListItemID) { selected = i }
+	list.OnUnselected = func(widget.ListItemID) { selected = -1 }
+
+	current := func() (EquipmentItem, bool) {
+		if selected < 0 || selected >= len(items) {
+			return EquipmentItem{}, false
+		}
+		return items[selected], true
+	}
+	report := func(err error) {
+		if err != nil {
+			dialog.ShowError(err, mainWindow)
+		}
+		snap = snapshotState()
+		reload()
+	}
+
+	lend := widget.NewButtonWithIcon("Lend...", theme.ContentRedoIcon(), func() {
+		if it, ok := current(); ok {
+			showLendDialog(it, func(err error) { report(err) })
+		}
+	})
+	ret := widget.NewButtonWithIcon("Return", theme.ContentUndoIcon(), func() {
+		if it, ok := current(); ok {
+			report(returnEquipment(it.ID, actingStaff()))
+		}
+	})
+	add := widget.NewButtonWithIcon("Add...", theme.ContentAddIcon(), func() {
+		if !requirePermission(permEquipment, "add equipment") {
+			return
+		}
+		name := widget.NewEntry()
+		name.SetPlaceHolder("Controller 3")
+		kind := widget.NewSelectEntry([]string{"Controller", "Headset", "Racing wheel"})
+		dialog.ShowForm("Add Equipment", "Add", "Cancel", []*widget.FormItem{
+			widget.NewFormItem("Name", name),
+			widget.NewFormItem("Kind", kind),
+		}, func(ok bool) {
+			if ok {
+				_, err := addEquipmentItem(name.Text, kind.Text, actingStaff())
+				report(err)
+			}
+		}, mainWindow)
+	})
+	retire := widget.NewButtonWithIcon("Retire", theme.DeleteIcon(), func() {
+		it, ok := current()
+		if !ok || !requirePermission(permEquipment, "retire equipment") {
+			return
+		}
+		dialog.ShowConfirm("Retire Item", fmt.Sprintf("Remove %s from the inventory? Its history is kept.", it.Name), func(ok bool) {
+			if ok {
+				report(retireEquipmentItem(it.ID, actingStaff()))
+			}
+		}, mainWindow)
+	})
+	history := widget.NewButtonWithIcon("History", theme.HistoryIcon(), func() { showLoanHistory(data.Loans, snap) })
+
+	buttons := container.NewHBox(lend, ret, widget.NewSeparator(), add, retire, layout.NewSpacer(), history)
+	dlg := dialog.NewCustom("Equipment", "Close", container.NewBorder(nil, buttons, nil, nil, list), mainWindow)
+	dlg.Resize(fyne.NewSize(620, 480))
+	dlg.Show()
+}
+
+// showLendDialog picks who gets the item from the users checked in.
+func showLendDialog(it EquipmentItem, done func(error)) {
+	snap := snapshotState()
+	users := snap.Users
+	if len(users) == 0 {
+		dialog.ShowInformation("Lend "+it.Name, "Nobody is checked in.", mainWindow)
+		return
+	}
+	display := make([]string, len(users))
+	for i, u := range users {
+		display[i] = fmt.Sprintf("%s (ID: %s) - %s", u.Name, u.ID, snapDeviceName(snap, u.PCID))
+	}
+	sel := widget.NewSelect(display, nil)
+	sel.PlaceHolder = "Select user"
+	dialog.ShowForm("Lend "+it.Name, "Lend", "Cancel", []*widget.FormItem{widget.NewFormItem("To", sel)}, func(ok bool) {
+		if !ok || sel.SelectedIndex() < 0 {
+			return
+		}
+		done(lendEquipment(it.ID, users[sel.SelectedIndex()].ID, actingStaff()))
+	}, mainWindow)
+}
+
+// showLoanHistory lists every loan, newest first, filtered by item or user.
+func showLoanHistory(loans []Loan, snap stateSnapshot) {
+	all := append([]Loan{}, loans...)
+	sort.SliceStable(all, func(i, j int) bool { return all[i].Out.After(all[j].Out) })
+	shown := all
+
+	list := widget.NewList(
+		func() int { return len(shown) },
+		func() fyne.CanvasObject { return widget.NewLabel("") },
+		func(i widget.ListItemID, o fyne.CanvasObject) {
+			o.(*widget.Label).SetText(formatLoan(shown[i], snap))
+		})
+	filter := widget.NewEntry()
+	filter.SetPlaceHolder("Filter by item, user name or ID...")
+	filter.OnChanged = func(s string) {
+		q := strings.ToLower(strings.TrimSpace(s))
+		shown = all
+		if q != "" {
+			shown = nil
+			for _, l := range all {
+				if strings.Contains(strings.ToLower(l.ItemName+" "+l.UserName+" "+l.UserID), q) {
+					shown = append(shown, l)
+				}
+			}
+		}
+		list.Refresh()
+	}
+	dlg := dialog.NewCustom("Equipment History", "Close", container.NewBorder(filter, nil, nil, nil, list), mainWindow)
+	dlg.Resize(fyne.NewSize(720, 520))
+	dlg.Show()
+}
+
+func formatLoan(l Loan, snap stateSnapshot) string {
+	until := "still out"
+	if !l.isOut() {
+		until = l.Returned.Format("15:04")
+		if l.Returned.YearDay() != l.Out.YearDay() || l.Returned.Year() != l.Out.Year() {
+			until = l.Returned.Format("Jan 02 15:04")
+		}
+	}
+	return fmt.Sprintf("%s-%s  %s: %s (%s), %s", l.Out.Format("Jan 02 15:04"), until, l.ItemName, l.UserName, l.UserID, snapDeviceName(snap, l.DeviceID))
+}
+
+// snapDeviceName is deviceName for code that holds a snapshot, not the lock.
+func snapDeviceName(snap stateSnapshot, id int) string {
+	if id == 0 {
+		return "the queue"
+	}
+	return fmt.Sprintf("%s %d", deviceTypeName(snap, id), id)
+}
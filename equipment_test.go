@@ -0,0 +1,38 @@
+package main
+
+import "testing"
+
+// TestCheckoutReturnsLoans checks that a checkout reports what is still out
+// and publishes it, whichever front end did it.
+func TestCheckoutReturnsLoans(t *testing.T) {
+	setupTestLounge(t)
+	item, err := addEquipmentItem("Controller 3", "Controller", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := registerUser("Ann", "a1", 3, "", "test"); err != nil {
+		t.Fatal(err)
+	}
+	if err := lendEquipment(item.ID, "a1", "test"); err != nil {
+		t.Fatal(err)
+	}
+	since := loungeEvents.lastSeq()
+
+	loans, err := checkoutUser("a1", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loans) != 1 || loans[0].ItemName != "Controller 3" {
+		t.Fatalf("checkout returned %v, want the controller", loans)
+	}
+	events, _ := loungeEvents.since(since)
+	for _, ev := range events {
+		if ev.Type == EventCheckOut {
+			if ev.Message != "still borrowed: Controller 3" {
+				t.Fatalf("checkout event says %q", ev.Message)
+			}
+			return
+		}
+	}
+	t.Fatal("no checkout event")
+}
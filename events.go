@@ -0,0 +1,352 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ---------- Lounge events ----------
+
+const (
+	EventCheckIn    = "checkin"
+	EventQueueJoin  = "queue_join"
+	EventCheckOut   = "checkout"
+	EventQueueLeave = "queue_leave"
+	EventAssign     = "assign"
+	EventSwitch     = "switch"
+
+	// EventUndo and EventRedo report a front-desk operation being reverted or
+	// re-applied; UserID and DeviceID describe where the user ended up.
+	EventUndo = "undo"
+	EventRedo = "redo"
+
+	// EventDeviceFreed follows a checkout or switch that left DeviceID free.
+	EventDeviceFreed = "device_freed"
+
+	// EventClosingSoon is sent once, warn_minutes before closing time.
+	EventClosingSoon = "closing_soon"
+
+	// EventAlert is sent when an alert rule starts matching; Message says
+	// what it matched and DeviceID is the first device involved.
+	EventAlert = "alert"
+
+	// EventTournament is sent when an event is added, ended or deleted;
+	// Message says which. Starting and ending on schedule are only notified
+	// in-process, to redraw the floor plan.
+	EventTournament = "tournament"
+
+	// EventReload means another instance changed the shared data files and
+	// the state was reloaded from disk.
+	EventReload = "reload"
+
+	// EventLogUpdated is an in-process notification that the daily log was
+	// rewritten; it is not streamed to API clients.
+	EventLogUpdated = "log_updated"
+
+	// EventAgentStatus is an in-process notification that a PC agent
+	// connected, disconnected or changed lock state.
+	EventAgentStatus = "agent_status"
+
+	// EventResync tells a stream client that events were lost (buffer overrun
+	// or app restart) and it should reload /api/status.
+	EventResync = "resync"
+)
+
+type LoungeEvent struct {
+	Seq          uint64    `json:"seq"`
+	Type         string    `json:"type"`
+	Time         time.Time `json:"time"`
+	UserID       string    `json:"user_id,omitempty"`
+	UserName     string    `json:"user_name,omitempty"`
+	DeviceID     int       `json:"device_id,omitempty"`
+	FromDeviceID int       `json:"from_device_id,omitempty"`
+	Message      string    `json:"message,omitempty"`
+}
+
+const eventBufferSize = 1024
+
+// eventLog keeps the most recent events so reconnecting clients can resume
+// from the last sequence number they saw.
+type eventLog struct {
+	mu      sync.Mutex
+	nextSeq uint64
+	buf     []LoungeEvent
+	waiters map[chan struct{}]struct{}
+}
+
+var loungeEvents = &eventLog{nextSeq: 1, waiters: map[chan struct{}]struct{}{}}
+
+func (l *eventLog) append(ev LoungeEvent) LoungeEvent {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	ev.Seq = l.nextSeq
+	l.nextSeq++
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+	l.buf = append(l.buf, ev)
+	if len(l.buf) > eventBufferSize {
+		l.buf = l.buf[len(l.buf)-eventBufferSize:]
+	}
+	for ch := range l.waiters {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+	return ev
+}
+
+// since returns the buffered events after seq. ok is false when events after
+// seq are no longer (or never were) in the buffer.
+func (l *eventLog) since(seq uint64) (events []LoungeEvent, ok bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	last := l.nextSeq - 1
+	if seq > last {
+		return nil, false
+	}
+	if len(l.buf) > 0 && seq+1 < l.buf[0].Seq {
+		return nil, false
+	}
+	for _, ev := range l.buf {
+		if ev.Seq > seq {
+			events = append(events, ev)
+		}
+	}
+	return events, true
+}
+
+func (l *eventLog) lastSeq() uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.nextSeq - 1
+}
+
+func (l *eventLog) subscribe() chan struct{} {
+	ch := make(chan struct{}, 1)
+	l.mu.Lock()
+	l.waiters[ch] = struct{}{}
+	l.mu.Unlock()
+	return ch
+}
+
+func (l *eventLog) unsubscribe(ch chan struct{}) {
+	l.mu.Lock()
+	delete(l.waiters, ch)
+	l.mu.Unlock()
+}
+
+// ---------- Change notification bus ----------
+
+// maxPendingEvents bounds a slow subscriber's backlog; subscribers treat a
+// batch as "these things changed", so dropping the oldest is harmless.
+const maxPendingEvents = 256
+
+// eventBus fans events out to in-process subscribers without blocking the
+// publisher. Events that arrive while a subscriber is busy are coalesced and
+// delivered together in one call.
+type eventBus struct {
+	mu   sync.Mutex
+	subs []*eventSubscription
+}
+
+type eventSubscription struct {
+	types   map[string]bool // nil accepts every type
+	handler func([]LoungeEvent)
+
+	mu      sync.Mutex
+	pending []LoungeEvent
+	signal  chan struct{}
+	done    chan struct{}
+	closing sync.Once
+}
+
+func (s *eventSubscription) close() { s.closing.Do(func() { close(s.done) }) }
+
+var loungeBus = &eventBus{}
+
+// subscribe calls handler from a dedicated goroutine with batches of events of
+// the given types, or of every type when none are given, until the returned
+// unsubscribe is called.
+func (b *eventBus) subscribe(handler func([]LoungeEvent), types ...string) (unsubscribe func()) {
+	sub := &eventSubscription{handler: handler, signal: make(chan struct{}, 1), done: make(chan struct{})}
+	if len(types) > 0 {
+		sub.types = map[string]bool{}
+		for _, t := range types {
+			sub.types[t] = true
+		}
+	}
+	b.mu.Lock()
+	b.subs = append(b.subs, sub)
+	b.mu.Unlock()
+	go sub.run()
+	return func() { b.remove(sub) }
+}
+
+func (b *eventBus) remove(sub *eventSubscription) {
+	b.mu.Lock()
+	for i, s := range b.subs {
+		if s == sub {
+			b.subs = append(b.subs[:i:i], b.subs[i+1:]...)
+			break
+		}
+	}
+	b.mu.Unlock()
+	sub.close()
+}
+
+// unsubscribeAll drops every subscriber; tests use it so handlers do not
+// outlive the test that set them up.
+func (b *eventBus) unsubscribeAll() {
+	b.mu.Lock()
+	subs := b.subs
+	b.subs = nil
+	b.mu.Unlock()
+	for _, s := range subs {
+		s.close()
+	}
+}
+
+func (b *eventBus) publish(ev LoungeEvent) {
+	b.mu.Lock()
+	subs := append([]*eventSubscription{}, b.subs...)
+	b.mu.Unlock()
+	for _, sub := range subs {
+		if sub.types != nil && !sub.types[ev.Type] {
+			continue
+		}
+		sub.mu.Lock()
+		sub.pending = append(sub.pending, ev)
+		if len(sub.pending) > maxPendingEvents {
+			sub.pending = sub.pending[len(sub.pending)-maxPendingEvents:]
+		}
+		sub.mu.Unlock()
+		select {
+		case sub.signal <- struct{}{}:
+		default: // already signalled; the batch picks this event up
+		}
+	}
+}
+
+func (s *eventSubscription) run() {
+	for {
+		select {
+		case <-s.signal:
+		case <-s.done:
+			return
+		}
+		s.mu.Lock()
+		batch := s.pending
+		s.pending = nil
+		s.mu.Unlock()
+		if len(batch) > 0 {
+			s.handler(batch)
+		}
+	}
+}
+
+// publishEvent records a state change for API streams and notifies
+// in-process subscribers. It never blocks.
+func publishEvent(ev LoungeEvent) {
+	ev = loungeEvents.append(ev)
+	loungeBus.publish(ev)
+	queueWebhooks(ev)
+	runHooks(ev)
+}
+
+// notifyLocal tells in-process subscribers about a change that API clients
+// do not need to see.
+func notifyLocal(ev LoungeEvent) {
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+	loungeBus.publish(ev)
+}
+
+// onUIEvents subscribes a handler that runs on the Fyne thread.
+func onUIEvents(handler func([]LoungeEvent), types ...string) {
+	loungeBus.subscribe(func(batch []LoungeEvent) {
+		runOnUI(func() { handler(batch) })
+	}, types...)
+}
+
+// ---------- Server-sent events endpoint ----------
+
+// serveEventStream streams events as SSE. Clients resume with the standard
+// Last-Event-ID header or a ?since=<seq> query parameter.
+func serveEventStream(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeAPIError(w, http.StatusInternalServerError, fmt.Errorf("streaming not supported"))
+		return
+	}
+
+	since := loungeEvents.lastSeq()
+	resume := r.Header.Get("Last-Event-ID")
+	if q := r.URL.Query().Get("since"); q != "" {
+		resume = q
+	}
+	if resume != "" {
+		n, err := strconv.ParseUint(resume, 10, 64)
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, fmt.Errorf("invalid event sequence %q", resume))
+			return
+		}
+		since = n
+	}
+
+	notify := loungeEvents.subscribe()
+	defer loungeEvents.unsubscribe(notify)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(20 * time.Second)
+	defer keepAlive.Stop()
+
+	for {
+		events, ok := loungeEvents.since(since)
+		if !ok {
+			since = loungeEvents.lastSeq()
+			events = nil
+			if err := writeSSE(w, LoungeEvent{Seq: since, Type: EventResync, Time: time.Now()}); err != nil {
+				return
+			}
+		}
+		for _, ev := range events {
+			if err := writeSSE(w, ev); err != nil {
+				return
+			}
+			since = ev.Seq
+		}
+		flusher.Flush()
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-notify:
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+func writeSSE(w http.ResponseWriter, ev LoungeEvent) error {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", ev.Seq, ev.Type, data)
+	return err
+}
@@ -0,0 +1,11 @@
+//go:build !unix && !windows
+
+package main
+
+import "os"
+
+// Platforms without file locking (the web build) run as a single instance.
+
+func lockFile(*os.File) error    { return nil }
+func tryLockFile(*os.File) error { return nil }
+func unlockFile(*os.File) error  { return nil }
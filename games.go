@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// ---------- Games ----------
+//
+// "games" under a device in log/config.json lists the games installed on it.
+// A check-in may name one of them; the game is kept on the session and its
+// log entry so the report can show play hours per game.
+
+// noGame is the check-in dialog's choice for not naming a game.
+const noGame = "None"
+
+// deviceGames is the installed-games catalogue of a device. For the queue
+// (device 0) it is every game installed anywhere.
+func deviceGames(id int) []string {
+	if id != 0 {
+		return deviceConfig(id).Games
+	}
+	seen := map[string]bool{}
+	var all []string
+	for _, dc := range appConfig.Devices {
+		for _, g := range dc.Games {
+			if !seen[g] {
+				seen[g] = true
+				all = append(all, g)
+			}
+		}
+	}
+	sort.Strings(all)
+	return all
+}
+
+// checkGame accepts no game or one installed on the device.
+func checkGame(deviceID int, game string) error {
+	if game == "" || containsString(deviceGames(deviceID), game) {
+		return nil
+	}
+	if deviceID == 0 {
+		return fmt.Errorf("%q is not installed on any device", game)
+	}
+	return fmt.Errorf("%q is not installed on device %d", game, deviceID)
+}
+
+type gameUsage struct {
+	Game     string  `json:"game"`
+	Sessions int     `json:"sessions"`
+	Hours    float64 `json:"hours"`
+}
+
+// gameUsageFor totals the finished sessions per game, most played first.
+// A session that moved counts its time on each device toward that device's
+// game; time without a game is left out.
+func gameUsageFor(entries []LogEntry) []gameUsage {
+	byGame := map[string]*gameUsage{}
+	for _, e := range entries {
+		if e.PCID == 0 || e.CheckOutTime.IsZero() {
+			continue
+		}
+		counted := map[string]bool{}
+		for _, s := range e.segments() {
+			if s.Game == "" {
+				continue
+			}
+			gu := byGame[s.Game]
+			if gu == nil {
+				gu = &gameUsage{Game: s.Game}
+				byGame[s.Game] = gu
+			}
+			if !counted[s.Game] {
+				counted[s.Game] = true
+				gu.Sessions++
+			}
+			gu.Hours += s.hours()
+		}
+	}
+	out := []gameUsage{}
+	for _, gu := range byGame {
+		out = append(out, *gu)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Hours != out[j].Hours {
+			return out[i].Hours > out[j].Hours
+		}
+		return out[i].Game < out[j].Game
+	})
+	return out
+}
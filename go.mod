@@ -2,7 +2,10 @@ module lounge
 
 go 1.23.1
 
-require fyne.io/fyne/v2 v2.6.1
+require (
+	fyne.io/fyne/v2 v2.6.1
+	golang.org/x/sys v0.30.0
+)
 
 require (
 	fyne.io/systray v1.11.0 // indirect
@@ -34,7 +37,6 @@ require (
 	github.com/yuin/goldmark v1.7.8 // indirect
 	golang.org/x/image v0.24.0 // indirect
 	golang.org/x/net v0.35.0 // indirect
-	golang.org/x/sys v0.30.0 // indirect
 	golang.org/x/text v0.22.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
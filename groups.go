@@ -0,0 +1,357 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+)
+
+// ---------- Group check-in ----------
+//
+// Friends who arrive together are seated side by side: on a run of free PCs
+// in one row of the floor plan, or, for bigger groups, a block over
+// neighbouring rows. When no such seats are free the group is queued with a
+// shared Group ID and seated as a unit as soon as they are.
+
+// actorSeating is recorded for groups seated automatically from the queue.
+const actorSeating = "seating"
+
+// floorSlots is the saved floor plan with unplaced devices in their default
+// slots.
+func floorSlots() map[int]int {
+	slots, _ := readDeviceLayout()
+	fillDefaultSlots(slots, defaultDeviceOrder)
+	return slots
+}
+
+// adjacentFreePCs finds n free PCs next to each other, trying a single row
+// first and then blocks over more rows. The IDs come back row by row, left
+// to right; nil means there is no such block.
+func adjacentFreePCs(snap stateSnapshot, slots map[int]int, n int, now time.Time) []int {
+	grid := make([][]int, len(layoutRows))
+	for r, cols := range layoutRows {
+		grid[r] = make([]int, cols)
+	}
+	for _, d := range snap.Devices {
+		if d.Type != "PC" || d.Status != "free" || snap.reservation(d.ID, now) != nil {
+			continue
+		}
+		if slot, ok := slots[d.ID]; ok {
+			if r, c := slotRowCol(slot); r >= 0 {
+				grid[r][c] = d.ID
+			}
+		}
+	}
+	for h := 1; h <= len(grid) && h <= n; h++ {
+		w := (n + h - 1) / h
+		for r := 0; r+h <= len(grid); r++ {
+			for c := 0; c+w <= len(grid[r]); c++ {
+				if ids := takeBlock(grid, r, c, w, n); ids != nil {
+					return ids
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// takeBlock reads n cells row by row from the w-wide block at row r, column
+// c; it returns nil if any of them is missing or taken.
+func takeBlock(grid [][]int, r, c, w, n int) []int {
+	ids := make([]int, 0, n)
+	for ; len(ids) < n; r++ {
+		if r >= len(grid) || c+w > len(grid[r]) {
+			return nil
+		}
+		for col := c; col < c+w && len(ids) < n; col++ {
+			if grid[r][col] == 0 {
+				return nil
+			}
+			ids = append(ids, grid[r][col])
+		}
+	}
+	return ids
+}
+
+// liveSnapshot wraps the live state without copying it; call holding the
+// state lock and do not keep the result.
+func liveSnapshot() stateSnapshot {
+	return stateSnapshot{Devices: allDevices, Users: activeUsers, Tournaments: tournaments}
+}
+
+// checkInGroup seats the group on adjacent PCs, or queues them together when
+// there are none free. It returns the PCs in member order, or nil if the
+// group was queued.
+func checkInGroup(group []Member, by string, afterHours bool) ([]int, error) {
+	if len(group) < 2 {
+		return nil, fmt.Errorf("a group needs at least two members")
+	}
+	seen := map[string]bool{}
+	for _, m := range group {
+		if m.ID == "" || m.Name == "" {
+			return nil, fmt.Errorf("every member needs a name and an ID")
+		}
+		if seen[m.ID] {
+			return nil, fmt.Errorf("user ID %s is in the group twice", m.ID)
+		}
+		seen[m.ID] = true
+	}
+	slots := floorSlots()
+
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	for _, m := range group {
+		if u := getUserByID(m.ID); u != nil {
+			return nil, fmt.Errorf("user ID %s (%s) is already checked in", m.ID, u.Name)
+		}
+	}
+	now := time.Now()
+	if closed := checkOpen(now); closed != nil {
+		if !afterHours {
+			return nil, closed
+		}
+		recordAudit(by, auditAfterHours, "group", nil, map[string]any{"members": group}, nil)
+	}
+
+	devices := adjacentFreePCs(liveSnapshot(), slots, len(group), now)
+	groupID := ""
+	if devices == nil {
+		groupID = "g" + strconv.FormatInt(now.UnixMilli(), 36)
+	}
+	deviceFor := func(i int) int {
+		if devices == nil {
+			return 0
+		}
+		return devices[i]
+	}
+	// Check everyone before changing anything, so the group is checked in
+	// whole or not at all. Members have their own IDs and seats, so checking
+	// one in cannot make another's check fail.
+	for i, m := range group {
+		if err := checkRegisterLocked(m.ID, deviceFor(i)); err != nil {
+			return nil, err
+		}
+	}
+
+	steps := make([]undoStep, 0, len(group))
+	names := make([]string, 0, len(group))
+	for i, m := range group {
+		action := EventCheckIn
+		if deviceFor(i) == 0 {
+			action = EventQueueJoin
+		}
+		err := registerUserLocked(m.Name, m.ID, deviceFor(i), "", "", "", by)
+		if err == nil {
+			activeUsers[indexOfUser(activeUsers, m.ID)].Group = groupID
+		}
+		auditUserChange(by, action, m.ID, nil, &err)
+		if err != nil {
+			return nil, err // ruled out by checkRegisterLocked above
+		}
+		idx := indexOfUser(activeUsers, m.ID)
+		steps = append(steps, undoStep{Kind: undoStepAdd, After: activeUsers[idx], Index: idx})
+		names = append(names, m.Name)
+	}
+	if groupID != "" {
+		saveData()
+	}
+	recordUndo(undoOp{Label: "group check-in of " + strings.Join(names, ", "), By: by, Steps: steps})
+	return devices, nil
+}
+
+// queuedGroupsLocked lists the groups waiting in the queue, in queue order.
+func queuedGroupsLocked() [][]User {
+	var order []string
+	byID := map[string][]User{}
+	for _, u := range activeUsers {
+		if u.PCID != 0 || u.Group == "" {
+			continue
+		}
+		if _, ok := byID[u.Group]; !ok {
+			order = append(order, u.Group)
+		}
+		byID[u.Group] = append(byID[u.Group], u)
+	}
+	groups := make([][]User, len(order))
+	for i, id := range order {
+		groups[i] = byID[id]
+	}
+	return groups
+}
+
+// seatQueuedGroups seats every queued group that now fits on adjacent PCs.
+func seatQueuedGroups() {
+	slots := floorSlots()
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	now := time.Now()
+	for _, g := range queuedGroupsLocked() {
+		devices := adjacentFreePCs(liveSnapshot(), slots, len(g), now)
+		if devices == nil {
+			continue
+		}
+		if err := checkSeatsLocked(g, devices, now); err != nil {
+			fmt.Println("Error seating group:", err)
+			continue
+		}
+		steps := make([]undoStep, 0, len(g))
+		names := make([]string, 0, len(g))
+		for i, u := range g {
+			before := u
+			step, err := assignQueuedUserLocked(u.ID, devices[i])
+			auditUserChange(actorSeating, EventAssign, u.ID, &before, &err)
+			if err != nil {
+				fmt.Println("Error seating group:", err) // ruled out by checkSeatsLocked
+				continue
+			}
+			steps = append(steps, step)
+			names = append(names, u.Name)
+		}
+		recordUndo(undoOp{Label: "seating of " + strings.Join(names, ", "), By: actorSeating, Steps: steps})
+	}
+}
+
+// checkSeatsLocked checks every queued member against their seat before any
+// of them is moved, so a group is seated whole or not at all.
+func checkSeatsLocked(group []User, devices []int, now time.Time) error {
+	for i, u := range group {
+		if err := checkAssignLocked(u.ID, devices[i], now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var groupSeating sync.Once
+
+// startGroupSeating seats queued groups whenever PCs free up. Like the
+// webhook sender it runs only holding the instance lock, so two processes
+// never seat the same group.
+func startGroupSeating() {
+	groupSeating.Do(func() {
+		seatQueuedGroups()
+		loungeBus.subscribe(func([]LoungeEvent) { seatQueuedGroups() },
+			EventDeviceFreed, EventReload, EventUndo, EventRedo, EventTournament)
+	})
+}
+
+// ---------- Group dialog ----------
+
+func showGroupCheckInDialog() {
+	var group []Member
+	var groupList *widget.List
+	var dlg dialog.Dialog
+
+	add := func(m Member) {
+		m.Name, m.ID = strings.TrimSpace(m.Name), strings.TrimSpace(m.ID)
+		if m.Name == "" || m.ID == "" {
+			return
+		}
+		for _, g := range group {
+			if g.ID == m.ID {
+				return
+			}
+		}
+		group = append(group, m)
+		groupList.Refresh()
+	}
+
+	groupList = widget.NewList(
+		func() int { return len(group) },
+		func() fyne.CanvasObject {
+			return container.NewBorder(nil, nil, nil, widget.NewButtonWithIcon("", theme.DeleteIcon(), nil), widget.NewLabel(""))
+		},
+		func(i widget.ListItemID, o fyne.CanvasObject) {
+			row := o.(*fyne.Container)
+			row.Objects[0].(*widget.Label).SetText(fmt.Sprintf("%d. %s (%s)", i+1, group[i].Name, group[i].ID))
+			row.Objects[1].(*widget.Button).OnTapped = func() {
+				group = append(group[:i], group[i+1:]...)
+				groupList.Refresh()
+			}
+		})
+
+	var matches []Member
+	results := widget.NewList(
+		func() int { return len(matches) },
+		func() fyne.CanvasObject { return widget.NewLabel("") },
+		func(i widget.ListItemID, o fyne.CanvasObject) {
+			o.(*widget.Label).SetText(fmt.Sprintf("%s (%s)", matches[i].Name, matches[i].ID))
+		})
+	resultsScroll := container.NewVScroll(results)
+	resultsScroll.SetMinSize(fyne.NewSize(0, 120))
+	search := widget.NewEntry()
+	search.SetPlaceHolder("Search members to add (Name/ID)...")
+	search.OnChanged = func(s string) {
+		q := strings.ToLower(strings.TrimSpace(s))
+		matches = nil
+		if q != "" {
+			for _, m := range snapshotMembers() {
+				if strings.Contains(strings.ToLower(m.Name), q) || strings.Contains(strings.ToLower(m.ID), q) {
+					matches = append(matches, m)
+				}
+			}
+		}
+		results.Refresh()
+	}
+	results.OnSelected = func(i widget.ListItemID) {
+		add(matches[i])
+		results.UnselectAll()
+		search.SetText("")
+	}
+
+	nameEntry := widget.NewEntry()
+	nameEntry.SetPlaceHolder("Name")
+	idEntry := widget.NewEntry()
+	idEntry.SetPlaceHolder("ID")
+	addNew := widget.NewButtonWithIcon("Add", theme.ContentAddIcon(), func() {
+		add(Member{Name: nameEntry.Text, ID: idEntry.Text})
+		nameEntry.SetText("")
+		idEntry.SetText("")
+	})
+	noID := widget.NewButton("No ID?", func() { idEntry.SetText("LOUNGE-" + getNextMemberID()) })
+	newRow := container.NewBorder(nil, nil, nil, container.NewHBox(noID, addNew), container.NewGridWithColumns(2, nameEntry, idEntry))
+
+	report := func(devices []int) {
+		dlg.Hide()
+		if devices == nil {
+			dialog.ShowInformation("Group Queued",
+				fmt.Sprintf("There are no %d free PCs next to each other. The group is queued and will be seated together when there are.", len(group)), mainWindow)
+			return
+		}
+		var lines []string
+		for i, m := range group {
+			lines = append(lines, fmt.Sprintf("%s: PC %d", m.Name, devices[i]))
+		}
+		dialog.ShowInformation("Group Seated", strings.Join(lines, "\n"), mainWindow)
+	}
+	checkIn := widget.NewButtonWithIcon("Check In Group", theme.ConfirmIcon(), func() {
+		var devices []int
+		seat := func(afterHours bool) error {
+			var err error
+			devices, err = checkInGroup(group, actingStaff(), afterHours)
+			return err
+		}
+		if err := seat(false); err != nil {
+			if !offerAfterHours(err, func() error { return seat(true) }, func() { report(devices) }) {
+				dialog.ShowError(err, mainWindow)
+			}
+			return
+		}
+		report(devices)
+	})
+	checkIn.Importance = widget.HighImportance
+
+	top := container.NewVBox(search, resultsScroll, newRow, widget.NewLabel("Group:"))
+	content := container.NewBorder(top, checkIn, nil, nil, groupList)
+	dlg = dialog.NewCustom("Group Check-In", "Cancel", content, mainWindow)
+	dlg.Resize(fyne.NewSize(480, 560))
+	dlg.Show()
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+// TestSeatQueuedGroupLogsAssignment seats a group straight after it queued;
+// the log entries written for the queue must end up on the group's PCs.
+func TestSeatQueuedGroupLogsAssignment(t *testing.T) {
+	setupTestLounge(t)
+	for pc := 1; pc <= 16; pc++ {
+		id := fmt.Sprintf("p%d", pc)
+		if err := registerUser("User "+id, id, pc, "", "test"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	group := []Member{{Name: "Ann", ID: "a1"}, {Name: "Bob", ID: "b1"}}
+	if devices, err := checkInGroup(group, "test", false); err != nil || devices != nil {
+		t.Fatalf("group got %v, %v; want it queued", devices, err)
+	}
+	for pc := 1; pc <= 16; pc++ {
+		if _, err := checkoutUser(fmt.Sprintf("p%d", pc), "test"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	seatQueuedGroups()
+	flushLogWrites()
+
+	entries, err := readDailyLogEntries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range group {
+		u := snapshotState().user(m.ID)
+		if u == nil || u.PCID == 0 {
+			t.Fatalf("%s was not seated", m.Name)
+		}
+		if i := findSessionEntry(entries, *u); i < 0 {
+			t.Errorf("no log entry for %s", m.Name)
+		} else if entries[i].PCID != u.PCID {
+			t.Errorf("%s is on PC %d but the log says %d", m.Name, u.PCID, entries[i].PCID)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ---------- Hook scripts ----------
+//
+// "hooks" in log/config.json maps on_<event> (on_checkout, on_queue_join, ...)
+// to a program run for every event of that type. It gets the event as JSON on
+// stdin and in LOUNGE_* environment variables. Hooks run one at a time on a
+// background goroutine, in event order, and their output goes to
+// log/hooks.log.
+
+const (
+	hookLogFile        = "log/hooks.log"
+	hookLogMaxSize     = 1 << 20
+	hookDefaultTimeout = 10 * time.Second
+	hookOutputLimit    = 16 << 10
+)
+
+type HookConfig struct {
+	Command        string   `json:"command"`
+	Args           []string `json:"args,omitempty"`
+	TimeoutSeconds int      `json:"timeout_seconds,omitempty"`
+}
+
+func (h HookConfig) timeout() time.Duration {
+	if h.TimeoutSeconds > 0 {
+		return time.Duration(h.TimeoutSeconds) * time.Second
+	}
+	return hookDefaultTimeout
+}
+
+type hookRun struct {
+	name string
+	hook HookConfig
+	ev   LoungeEvent
+}
+
+var (
+	hookMu      sync.Mutex
+	hookPending []hookRun
+	hookSignal  = make(chan struct{}, 1)
+	hookWorker  sync.Once
+	// pendingHookRuns lets headless callers wait for hooks before exiting.
+	pendingHookRuns sync.WaitGroup
+)
+
+// runHooks queues the hook for ev, if one is configured. It never blocks.
+func runHooks(ev LoungeEvent) {
+	name := "on_" + ev.Type
+	hook, ok := appConfig.Hooks[name]
+	if !ok || hook.Command == "" {
+		return
+	}
+	hookWorker.Do(func() { go runHookQueue() })
+	pendingHookRuns.Add(1)
+	hookMu.Lock()
+	hookPending = append(hookPending, hookRun{name: name, hook: hook, ev: ev})
+	hookMu.Unlock()
+	select {
+	case hookSignal <- struct{}{}:
+	default:
+	}
+}
+
+func runHookQueue() {
+	for range hookSignal {
+		hookMu.Lock()
+		batch := hookPending
+		hookPending = nil
+		hookMu.Unlock()
+		for _, r := range batch {
+			out, err := runHook(r.hook, r.ev)
+			writeHookLog(r, out, err)
+			pendingHookRuns.Done()
+		}
+	}
+}
+
+// runHook runs one hook and returns its combined output, cut to
+// hookOutputLimit.
+func runHook(h HookConfig, ev LoungeEvent) ([]byte, error) {
+	payload, err := json.Marshal(ev)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), h.timeout())
+	defer cancel()
+	cmd := exec.CommandContext(ctx, h.Command, h.Args...)
+	cmd.Stdin = bytes.NewReader(payload)
+	cmd.Env = append(os.Environ(), hookEnv(ev)...)
+	cmd.WaitDelay = time.Second
+	var out limitedBuffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	err = cmd.Run()
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		err = fmt.Errorf("timed out after %s", h.timeout())
+	}
+	return out.Bytes(), err
+}
+
+func hookEnv(ev LoungeEvent) []string {
+	env := []string{
+		"LOUNGE_EVENT=" + ev.Type,
+		"LOUNGE_SEQ=" + strconv.FormatUint(ev.Seq, 10),
+		"LOUNGE_TIME=" + ev.Time.Format(time.RFC3339),
+		"LOUNGE_USER_ID=" + ev.UserID,
+		"LOUNGE_USER_NAME=" + ev.UserName,
+		"LOUNGE_MESSAGE=" + ev.Message,
+	}
+	if ev.DeviceID != 0 {
+		env = append(env, "LOUNGE_DEVICE_ID="+strconv.Itoa(ev.DeviceID))
+	}
+	if ev.FromDeviceID != 0 {
+		env = append(env, "LOUNGE_FROM_DEVICE_ID="+strconv.Itoa(ev.FromDeviceID))
+	}
+	return env
+}
+
+// limitedBuffer keeps the first hookOutputLimit bytes and drops the rest, so a
+// chatty hook cannot fill memory or the log.
+type limitedBuffer struct {
+	bytes.Buffer
+	dropped bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := hookOutputLimit - b.Len(); room < len(p) {
+		b.dropped = true
+		if room > 0 {
+			b.Buffer.Write(p[:room])
+		}
+		return len(p), nil
+	}
+	return b.Buffer.Write(p)
+}
+
+func (b *limitedBuffer) Bytes() []byte {
+	if b.dropped {
+		return append(b.Buffer.Bytes(), "\n[output truncated]"...)
+	}
+	return b.Buffer.Bytes()
+}
+
+// writeHookLog appends the result of a run, moving a full log to hooks.log.1.
+func writeHookLog(r hookRun, out []byte, runErr error) {
+	status := "ok"
+	if runErr != nil {
+		status = "failed: " + runErr.Error()
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %s (seq %d) %s: %s\n", time.Now().Format("2006-01-02 15:04:05"), r.name, r.ev.Seq, r.hook.Command, status)
+	if s := strings.TrimRight(string(out), "\n"); s != "" {
+		for _, line := range strings.Split(s, "\n") {
+			b.WriteString("    " + line + "\n")
+		}
+	}
+	if runErr != nil {
+		fmt.Printf("Hook %s failed: %v\n", r.name, runErr)
+	}
+
+	if fi, err := os.Stat(hookLogFile); err == nil && fi.Size() > hookLogMaxSize {
+		_ = os.Rename(hookLogFile, hookLogFile+".1")
+	}
+	f, err := os.OpenFile(hookLogFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		fmt.Println("Error writing hook log:", err)
+		return
+	}
+	defer f.Close()
+	if _, err := f.WriteString(b.String()); err != nil {
+		fmt.Println("Error writing hook log:", err)
+	}
+}
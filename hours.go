@@ -0,0 +1,301 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+)
+
+// ---------- Opening hours ----------
+//
+// With hours configured, check-ins are refused while the lounge is closed
+// unless staff override it, a warning goes out shortly before closing, and at
+// closing time everyone still checked in is checked out with the log entry
+// marked auto-closed.
+
+// actorClosing checks out whoever is left at closing time.
+const actorClosing = "closing"
+
+const auditAfterHours = "after_hours_checkin"
+
+var errLoungeClosed = errors.New("the lounge is closed")
+
+var weekdayKeys = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+type HoursConfig struct {
+	Enabled bool `json:"enabled"`
+	// Open and Close are "HH:MM"; a Close at or before Open is after midnight.
+	Open  string `json:"open"`
+	Close string `json:"close"`
+	// Days overrides the hours by weekday ("mon" ... "sun").
+	Days        map[string]DayHours `json:"days,omitempty"`
+	WarnMinutes int                 `json:"warn_minutes"`
+	// ShutdownAtClose powers off free PCs through their agents at closing.
+	ShutdownAtClose bool `json:"shutdown_at_close,omitempty"`
+}
+
+type DayHours struct {
+	Open   string `json:"open,omitempty"`
+	Close  string `json:"close,omitempty"`
+	Closed bool   `json:"closed,omitempty"`
+}
+
+func parseClock(s string) (time.Duration, error) {
+	h, m, ok := strings.Cut(strings.TrimSpace(s), ":")
+	hh, err1 := strconv.Atoi(h)
+	mm, err2 := strconv.Atoi(m)
+	if !ok || err1 != nil || err2 != nil || hh < 0 || hh > 23 || mm < 0 || mm > 59 {
+		return 0, fmt.Errorf("invalid time %q, want HH:MM", s)
+	}
+	return time.Duration(hh)*time.Hour + time.Duration(mm)*time.Minute, nil
+}
+
+// validateHours checks every configured time so a typo is reported at start
+// instead of silently keeping the lounge shut.
+func validateHours(h HoursConfig) error {
+	if !h.Enabled {
+		return nil
+	}
+	check := func(where, open, close string) error {
+		if _, err := parseClock(open); err != nil {
+			return fmt.Errorf("hours %s open: %w", where, err)
+		}
+		if _, err := parseClock(close); err != nil {
+			return fmt.Errorf("hours %s close: %w", where, err)
+		}
+		return nil
+	}
+	if err := check("default", h.Open, h.Close); err != nil {
+		return err
+	}
+	for day, d := range h.Days {
+		if !containsString(weekdayKeys, day) {
+			return fmt.Errorf("hours: unknown day %q, want one of %s", day, strings.Join(weekdayKeys, ", "))
+		}
+		if d.Closed {
+			continue
+		}
+		open, close := h.Open, h.Close
+		if d.Open != "" {
+			open = d.Open
+		}
+		if d.Close != "" {
+			close = d.Close
+		}
+		if err := check(day, open, close); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// periodFor returns the opening period that starts on day's date.
+func periodFor(h HoursConfig, day time.Time) (open, close time.Time, ok bool) {
+	openS, closeS := h.Open, h.Close
+	if d, found := h.Days[weekdayKeys[day.Weekday()]]; found {
+		if d.Closed {
+			return open, close, false
+		}
+		if d.Open != "" {
+			openS = d.Open
+		}
+		if d.Close != "" {
+			closeS = d.Close
+		}
+	}
+	o, err1 := parseClock(openS)
+	c, err2 := parseClock(closeS)
+	if err1 != nil || err2 != nil {
+		return open, close, false
+	}
+	if c <= o {
+		c += 24 * time.Hour
+	}
+	midnight := startOfDay(day)
+	return midnight.Add(o), midnight.Add(c), true
+}
+
+// openPeriod reports whether t falls in an opening period, including one that
+// started the day before and runs past midnight.
+func openPeriod(h HoursConfig, t time.Time) (open, close time.Time, isOpen bool) {
+	for _, day := range []time.Time{t.AddDate(0, 0, -1), t} {
+		o, c, ok := periodFor(h, day)
+		if ok && !t.Before(o) && t.Before(c) {
+			return o, c, true
+		}
+	}
+	return time.Time{}, time.Time{}, false
+}
+
+// lastClosing is the most recent closing time at or before t, looking back a
+// week; zero if there is none.
+func lastClosing(h HoursConfig, t time.Time) time.Time {
+	var last time.Time
+	for i := 7; i >= 0; i-- {
+		if _, c, ok := periodFor(h, t.AddDate(0, 0, -i)); ok && !c.After(t) && c.After(last) {
+			last = c
+		}
+	}
+	return last
+}
+
+// nextOpening is the first opening time after t, looking ahead a week.
+func nextOpening(h HoursConfig, t time.Time) time.Time {
+	for i := 0; i <= 7; i++ {
+		if o, _, ok := periodFor(h, t.AddDate(0, 0, i)); ok && o.After(t) {
+			return o
+		}
+	}
+	return time.Time{}
+}
+
+// checkOpen returns an error wrapping errLoungeClosed when check-ins are not
+// allowed at t.
+func checkOpen(t time.Time) error {
+	h := appConfig.Hours
+	if !h.Enabled {
+		return nil
+	}
+	if _, _, isOpen := openPeriod(h, t); isOpen {
+		return nil
+	}
+	if next := nextOpening(h, t); !next.IsZero() {
+		return fmt.Errorf("%w; it opens %s", errLoungeClosed, next.Format("Mon 15:04"))
+	}
+	return errLoungeClosed
+}
+
+// ---------- Closing time ----------
+
+var (
+	closingWarnedFor time.Time // Fyne thread only
+	closedFor        time.Time // Fyne thread only; closing already handled
+)
+
+// checkOpeningHours runs every minute on the Fyne thread: it warns before
+// closing and checks out whoever is left afterwards, once per closing time
+// unless that fails. Only the primary instance closes, so two desks do not
+// race over the same users.
+func checkOpeningHours(now time.Time) {
+	h := appConfig.Hours
+	if !h.Enabled || instanceLock == nil {
+		return
+	}
+	if _, c, isOpen := openPeriod(h, now); isOpen && h.WarnMinutes > 0 &&
+		c.Sub(now) <= time.Duration(h.WarnMinutes)*time.Minute && !closingWarnedFor.Equal(c) {
+		closingWarnedFor = c
+		msg := fmt.Sprintf("The lounge closes at %s. Everyone still checked in will be checked out automatically.", c.Format("15:04"))
+		fyne.CurrentApp().SendNotification(fyne.NewNotification("Closing soon", msg))
+		dialog.ShowInformation("Closing soon", msg, mainWindow)
+		publishEvent(LoungeEvent{Type: EventClosingSoon})
+		return
+	}
+	closedAt := lastClosing(h, now)
+	if closedAt.IsZero() || closedAt.Equal(closedFor) {
+		return
+	}
+	closedFor = closedAt
+	shutdown := shutdownDue(closedAt, now)
+	go func() {
+		n, loans, err := closeLounge(closedAt)
+		if err != nil {
+			fmt.Println("Error closing lounge:", err)
+			// Try again on the next tick; this run has finished by then.
+			fyne.Do(func() {
+				if closedFor.Equal(closedAt) {
+					closedFor = time.Time{}
+				}
+			})
+		}
+		if shutdown {
+			if err := shutdownFreePCs(actorClosing); err != nil {
+				fmt.Println("Error shutting down at closing:", err)
+			}
+		}
+		if n > 0 {
+			fyne.Do(func() {
+				msg := fmt.Sprintf("Closing time %s: checked out %d user(s).", closedAt.Format("15:04"), n)
+				if len(loans) > 0 {
+					msg += "\n\nStill borrowed: " + loansByUser(loans) + "."
+				}
+				dialog.ShowInformation("Closed", msg, mainWindow)
+			})
+		}
+	}()
+}
+
+// closeLounge checks out everyone who checked in before closedAt. Anyone let
+// in after closing by a staff override is left alone, which also makes it
+// safe to run again. It also returns the items people left with.
+func closeLounge(closedAt time.Time) (int, []Loan, error) {
+	var ids []string
+	for _, u := range snapshotState().Users {
+		if u.CheckInTime.Before(closedAt) {
+			ids = append(ids, u.ID)
+		}
+	}
+	n := 0
+	var loans []Loan
+	var errs []error
+	for _, id := range ids {
+		out, err := checkoutUser(id, actorClosing)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		loans = append(loans, out...)
+		n++
+	}
+	return n, loans, errors.Join(errs...)
+}
+
+// loansByUser is "Ann: Controller 3; Bob: Headset 1" for a closing summary.
+func loansByUser(loans []Loan) string {
+	var parts []string
+	for i := 0; i < len(loans); {
+		j := i
+		for j < len(loans) && loans[j].UserID == loans[i].UserID {
+			j++
+		}
+		parts = append(parts, loans[i].UserName+": "+loanItemNames(loans[i:j]))
+		i = j
+	}
+	return strings.Join(parts, "; ")
+}
+
+// offerAfterHours asks staff whether to let someone in anyway when err is a
+// closed-lounge refusal, running override and then done if they agree. It
+// reports whether err was such a refusal.
+func offerAfterHours(err error, override func() error, done func()) bool {
+	if !errors.Is(err, errLoungeClosed) {
+		return false
+	}
+	msg := strings.ToUpper(err.Error()[:1]) + err.Error()[1:] + ".\n\nCheck in anyway?"
+	dialog.ShowConfirm("Lounge Closed", msg, func(ok bool) {
+		if !ok {
+			return
+		}
+		if err := override(); err != nil {
+			dialog.ShowError(err, mainWindow)
+			return
+		}
+		if done != nil {
+			done()
+		}
+	}, mainWindow)
+	return true
+}
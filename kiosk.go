@@ -0,0 +1,264 @@
+package main
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/layout"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+)
+
+// ---------- Self-service kiosk ----------
+
+// kioskIdleReset returns the kiosk to the welcome screen after a member
+// walks away.
+const kioskIdleReset = 20 * time.Second
+
+var (
+	kioskActive       bool
+	kioskSavedContent fyne.CanvasObject
+	startInKiosk      bool
+)
+
+// kioskSession is the member currently using the kiosk.
+type kioskSession struct {
+	idEntry   *widget.Entry
+	message   *canvas.Text
+	detail    *canvas.Text
+	actions   *fyne.Container
+	idleTimer *time.Timer
+}
+
+// enterKioskMode swaps the main window for the self-service screen. The
+// toolbar and floor plan are hidden until a staff member exits with their
+// own ID and PIN, or with the kiosk PIN while there are no staff accounts.
+func enterKioskMode() {
+	if kioskActive || mainWindow == nil {
+		return
+	}
+	if !staffEnabled() && appConfig.Kiosk.PIN == "" {
+		dialog.ShowError(fmt.Errorf("add a staff account or set a kiosk PIN in %s before starting kiosk mode", configFile), mainWindow)
+		return
+	}
+	recordAudit(actingStaff(), auditKioskStart, "", nil, nil, nil)
+	kioskActive = true
+	kioskSavedContent = mainWindow.Content()
+	mainWindow.SetContent(buildKioskContent())
+	mainWindow.SetFullScreen(true)
+	mainWindow.SetCloseIntercept(promptKioskExit)
+}
+
+func exitKioskMode() {
+	if !kioskActive {
+		return
+	}
+	kioskActive = false
+	mainWindow.SetCloseIntercept(nil)
+	mainWindow.SetFullScreen(false)
+	mainWindow.SetContent(kioskSavedContent)
+	kioskSavedContent = nil
+	// Whoever was signed in before the kiosk started may have left.
+	lockScreen()
+}
+
+func promptKioskExit() {
+	id := widget.NewEntry()
+	id.SetPlaceHolder("Staff ID")
+	pin := widget.NewPasswordEntry()
+	pin.SetPlaceHolder("Staff PIN")
+	content := fyne.CanvasObject(pin)
+	if staffEnabled() {
+		content = container.NewVBox(id, pin)
+	}
+	dialog.ShowCustomConfirm("Exit Kiosk", "Exit", "Cancel", content, func(ok bool) {
+		if !ok {
+			return
+		}
+		by, err := checkKioskExit(id.Text, pin.Text)
+		if err != nil {
+			recordAudit(actorKiosk, auditKioskExitBad, strings.TrimSpace(id.Text), nil, nil, err)
+			dialog.ShowError(err, mainWindow)
+			return
+		}
+		recordAudit(by, auditKioskExit, "", nil, nil, nil)
+		exitKioskMode()
+	}, mainWindow)
+	if staffEnabled() {
+		mainWindow.Canvas().Focus(id)
+	} else {
+		mainWindow.Canvas().Focus(pin)
+	}
+}
+
+// checkKioskExit returns who may leave kiosk mode: the staff member whose ID
+// and PIN were entered, or the kiosk itself when there are no staff accounts
+// and the shared kiosk PIN matches.
+func checkKioskExit(id, pin string) (string, error) {
+	if staffEnabled() {
+		s, err := verifyStaffPIN(id, pin)
+		if err != nil {
+			return "", err
+		}
+		return s.ID, nil
+	}
+	if appConfig.Kiosk.PIN == "" || subtle.ConstantTimeCompare([]byte(pin), []byte(appConfig.Kiosk.PIN)) != 1 {
+		return "", fmt.Errorf("incorrect PIN")
+	}
+	return actorKiosk, nil
+}
+
+func buildKioskContent() fyne.CanvasObject {
+	s := &kioskSession{}
+
+	title := canvas.NewText("Welcome to the Lounge", theme.ForegroundColor())
+	title.TextSize = 40
+	title.TextStyle.Bold = true
+	title.Alignment = fyne.TextAlignCenter
+
+	s.message = canvas.NewText("", theme.ForegroundColor())
+	s.message.TextSize = 26
+	s.message.Alignment = fyne.TextAlignCenter
+	s.detail = canvas.NewText("", theme.ForegroundColor())
+	s.detail.TextSize = 18
+	s.detail.Alignment = fyne.TextAlignCenter
+
+	s.idEntry = widget.NewEntry()
+	s.idEntry.SetPlaceHolder("Scan your card or type your member ID")
+	s.idEntry.OnSubmitted = func(string) { s.lookup() }
+	enter := widget.NewButtonWithIcon("Continue", theme.NavigateNextIcon(), s.lookup)
+	enter.Importance = widget.HighImportance
+
+	idRow := container.New(&leftRatioLayout{ratio: 1, minW: 520, maxW: 520},
+		container.NewBorder(nil, nil, nil, enter, s.idEntry))
+	s.actions = container.NewHBox()
+
+	staff := widget.NewButtonWithIcon("Staff", theme.LogoutIcon(), promptKioskExit)
+	staff.Importance = widget.LowImportance
+
+	body := container.NewVBox(
+		title,
+		widget.NewSeparator(),
+		container.NewCenter(idRow),
+		s.message,
+		s.detail,
+		container.NewCenter(s.actions),
+	)
+	s.reset()
+	if mainWindow != nil {
+		mainWindow.Canvas().Focus(s.idEntry)
+	}
+	return container.NewBorder(nil, container.NewHBox(layout.NewSpacer(), staff), nil, nil, container.NewCenter(body))
+}
+
+func (s *kioskSession) reset() {
+	if s.idleTimer != nil {
+		s.idleTimer.Stop()
+		s.idleTimer = nil
+	}
+	s.idEntry.SetText("")
+	s.show("Scan or type your member ID to join the queue", "")
+	s.actions.Objects = nil
+	s.actions.Refresh()
+	if mainWindow != nil && kioskActive {
+		mainWindow.Canvas().Focus(s.idEntry)
+	}
+}
+
+func (s *kioskSession) show(message, detail string) {
+	s.message.Text = message
+	s.message.Refresh()
+	s.detail.Text = detail
+	s.detail.Refresh()
+}
+
+func (s *kioskSession) armIdleReset() {
+	if s.idleTimer != nil {
+		s.idleTimer.Stop()
+	}
+	s.idleTimer = time.AfterFunc(kioskIdleReset, func() { fyne.Do(s.reset) })
+}
+
+func (s *kioskSession) setActions(buttons ...fyne.CanvasObject) {
+	done := widget.NewButton("Done", s.reset)
+	s.actions.Objects = append(buttons, done)
+	s.actions.Refresh()
+}
+
+// lookup shows the entered member's state and lets them join the queue.
+// Anyone can type any member's ID, so leaving the queue and checking out are
+// left to the front desk.
+func (s *kioskSession) lookup() {
+	id := strings.TrimSpace(s.idEntry.Text)
+	s.idEntry.SetText("")
+	if id == "" {
+		return
+	}
+	s.armIdleReset()
+
+	if u := snapshotState().user(id); u != nil {
+		s.showActiveUser(*u)
+		return
+	}
+	var m *Member
+	for _, candidate := range snapshotMembers() {
+		if candidate.ID == id {
+			m = &candidate
+			break
+		}
+	}
+	if m == nil {
+		s.show("We couldn't find that ID", "Please ask at the front desk to register.")
+		s.setActions()
+		return
+	}
+	joinButton := func(label, wantType string) *widget.Button {
+		return widget.NewButtonWithIcon(label, theme.ContentAddIcon(), func() {
+			if err := queueUser(m.Name, m.ID, wantType, actorKiosk); err != nil {
+				s.show("Sorry, something went wrong", err.Error())
+				s.setActions()
+				return
+			}
+			u := snapshotState().user(m.ID)
+			if u == nil {
+				s.reset()
+				return
+			}
+			s.showActiveUser(*u)
+		})
+	}
+	join := joinButton("Join Queue", "")
+	join.Importance = widget.HighImportance
+	buttons := []fyne.CanvasObject{join}
+	if types := snapshotState().deviceTypes(); len(types) > 1 {
+		for _, t := range types {
+			buttons = append(buttons, joinButton("Wait for a "+t, t))
+		}
+	}
+	s.show("Hi "+firstLast(m.Name)+"!", "Join the queue and staff will assign you a station.")
+	s.setActions(buttons...)
+}
+
+func (s *kioskSession) showActiveUser(u User) {
+	s.armIdleReset()
+	if u.PCID == 0 {
+		pos := snapshotState().queuePosition(u.ID)
+		s.show(fmt.Sprintf("You're number %d in the queue, %s", pos, firstLast(u.Name)),
+			fmt.Sprintf("Waiting for %s. To leave the queue, please see the front desk.", formatDuration(time.Since(u.CheckInTime))))
+		s.setActions()
+		return
+	}
+	kind := "PC"
+	if d := snapshotState().device(u.PCID); d != nil {
+		kind = d.Type
+	}
+	s.show(fmt.Sprintf("You're on %s %d, %s", kind, u.PCID, firstLast(u.Name)),
+		fmt.Sprintf("Checked in %s ago. To check out, please see the front desk.", formatDuration(time.Since(u.CheckInTime))))
+	s.setActions()
+}
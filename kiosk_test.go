@@ -0,0 +1,35 @@
+package main
+
+import "testing"
+
+// TestKioskExitUsesStaffPINs checks that once staff accounts exist only a
+// staff ID and PIN leave kiosk mode, and the exit is theirs.
+func TestKioskExitUsesStaffPINs(t *testing.T) {
+	setupTestLounge(t)
+	appConfig.Kiosk.PIN = "2468"
+	saved := staffAccounts
+	t.Cleanup(func() { staffAccounts, loginFailures = saved, 0 })
+
+	staffAccounts = nil
+	if by, err := checkKioskExit("", "2468"); err != nil || by != actorKiosk {
+		t.Fatalf("kiosk PIN without staff: %q, %v", by, err)
+	}
+
+	s := Staff{ID: "amy", Name: "Amy", Role: RoleAttendant}
+	if err := setStaffPIN(&s, "1357"); err != nil {
+		t.Fatal(err)
+	}
+	staffAccounts = []Staff{s}
+	if err := saveStaff(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := checkKioskExit("", "2468"); err == nil {
+		t.Fatal("shared kiosk PIN still exits once staff exist")
+	}
+	if _, err := checkKioskExit("amy", "0000"); err == nil {
+		t.Fatal("wrong staff PIN exits")
+	}
+	if by, err := checkKioskExit("AMY", "1357"); err != nil || by != "amy" {
+		t.Fatalf("staff PIN: %q, %v", by, err)
+	}
+}
@@ -38,21 +38,28 @@ type User struct {
 	Name        string    `json:"name"`
 	CheckInTime time.Time `json:"checkin_time"`
 	PCID        int       `json:"pc_id"`
+	Game        string    `json:"game,omitempty"`
+	// Tournament is the ID of the event the user checked in for.
+	Tournament string `json:"tournament,omitempty"`
+	// Group is shared by members of a group queued to sit together.
+	Group string `json:"group,omitempty"`
+	// WantType is the device type a queued user asked for; empty for any.
+	WantType string `json:"want_type,omitempty"`
 }
 
 type Device struct {
-	ID     int
-	Type   string
-	Status string
-	UserID string
+	ID     int    `json:"id"`
+	Type   string `json:"type"`
+	Status string `json:"status"`
+	UserID string `json:"user_id,omitempty"`
 }
 
 type Member struct {
-	Name          string
-	ID            string
-	Email         string
-	StudentNumber string
-	PhoneNumber   string
+	Name          string `json:"name"`
+	ID            string `json:"id"`
+	Email         string `json:"email,omitempty"`
+	StudentNumber string `json:"student_number,omitempty"`
+	PhoneNumber   string `json:"phone_number,omitempty"`
 }
 
 type LogEntry struct {
@@ -62,6 +69,14 @@ type LogEntry struct {
 	CheckInTime  time.Time `json:"check_in_time"`
 	CheckOutTime time.Time `json:"check_out_time,omitempty"`
 	UsageTime    string    `json:"usage_time,omitempty"`
+	CheckInBy    string    `json:"check_in_by,omitempty"`
+	CheckOutBy   string    `json:"check_out_by,omitempty"`
+	Game         string    `json:"game,omitempty"`
+	Tournament   string    `json:"tournament,omitempty"`
+	// AutoClosed marks a session checked out at closing time.
+	AutoClosed bool `json:"auto_closed,omitempty"`
+	// Segments lists the devices of a session that moved (see segments.go).
+	Segments []Segment `json:"segments,omitempty"`
 }
 
 var (
@@ -70,10 +85,11 @@ var (
 	members           []Member
 	mainWindow        fyne.Window
 	logTable          *widget.Table
-	refreshTrigger    = make(chan bool, 1)
+	deviceLayout      *DeviceStatusLayoutWidget
 	logRefreshPending = false
 	logFileMutex      sync.Mutex
 	currentLogEntries []LogEntry
+	headless          bool
 
 	assignmentUserID         string
 	assignmentNoticeLabel    *widget.Label
@@ -125,19 +141,29 @@ func (r *pendingUserIconRenderer) Objects() []fyne.CanvasObject { return r.objec
 func (r *pendingUserIconRenderer) Destroy()                     {}
 
 func (w *PendingUserIcon) Tapped(_ *fyne.PointEvent) {
+	msg := "Choose an action for this queued user."
+	if w.user.WantType != "" {
+		msg = fmt.Sprintf("Waiting for a %s.\n\n", w.user.WantType) + msg
+	}
+	if w.user.Group != "" {
+		msg = "This user is queued with a group that is seated together\nas soon as enough adjacent PCs are free.\n\n" + msg
+	}
 	d := dialog.NewCustomConfirm(
 		fmt.Sprintf("Queued: %s (%s)", w.user.Name, w.user.ID),
 		"Assign",
 		"Remove",
-		widget.NewLabel("Choose an action for this queued user."),
+		widget.NewLabel(msg),
 		func(assign bool) {
 			if assign {
 				if w.onAssign != nil {
 					w.onAssign(w.user)
 				}
 			} else {
-				if err := removeQueuedUser(w.user.ID); err != nil {
+				loans, err := removeQueuedUser(w.user.ID, actingStaff())
+				if err != nil {
 					dialog.ShowError(err, mainWindow)
+				} else if len(loans) > 0 {
+					dialog.ShowInformation("Borrowed Items", fmt.Sprintf("%s still has: %s.", w.user.Name, loanItemNames(loans)), mainWindow)
 				}
 			}
 		},
@@ -166,7 +192,7 @@ func refreshPendingIcons() {
 	}
 	pendingIconsBox.Objects = pendingIconsBox.Objects[:0]
 	iconRes := ensureRaccoonIcon()
-	for _, u := range getPendingUsers() {
+	for _, u := range snapshotState().pending() {
 		user := u
 		icon := newPendingUserIcon(user, iconRes, func(sel User) {
 			assignmentUserID = sel.ID
@@ -212,29 +238,35 @@ func NewDeviceStatusLayoutWidget() *DeviceStatusLayoutWidget {
 	return w
 }
 
-func (w *DeviceStatusLayoutWidget) defaultOrder() []int {
-	return []int{16, 15, 14, 11, 12, 13, 10, 9, 8, 7, 6, 5, 1, 2, 3, 4, 17, 18}
-}
+// defaultDeviceOrder fills the slots when there is no saved layout.
+var defaultDeviceOrder = []int{16, 15, 14, 11, 12, 13, 10, 9, 8, 7, 6, 5, 1, 2, 3, 4, 17, 18}
+
+func (w *DeviceStatusLayoutWidget) defaultOrder() []int { return defaultDeviceOrder }
 
 func (w *DeviceStatusLayoutWidget) ensureMapping() {
 	if len(w.deviceToSlot) == len(allDevices) {
 		return
 	}
+	fillDefaultSlots(w.deviceToSlot, w.defaultOrder())
+}
+
+// fillDefaultSlots places every device missing from deviceToSlot into the
+// first free slot, in the given order.
+func fillDefaultSlots(deviceToSlot map[int]int, order []int) {
 	seen := make(map[int]bool)
-	for id := range w.deviceToSlot {
+	for id := range deviceToSlot {
 		seen[id] = true
 	}
-	order := w.defaultOrder()
 	slot := 0
 	occ := make(map[int]bool)
-	for _, s := range w.deviceToSlot {
+	for _, s := range deviceToSlot {
 		occ[s] = true
 	}
 	for _, d := range order {
 		if !seen[d] {
 			for {
 				if !occ[slot] {
-					w.deviceToSlot[d] = slot
+					deviceToSlot[d] = slot
 					occ[slot] = true
 					slot++
 					break
@@ -247,26 +279,36 @@ func (w *DeviceStatusLayoutWidget) ensureMapping() {
 
 func (w *DeviceStatusLayoutWidget) loadDeviceLayout() {
 	_ = ensureLogDir()
-	b, err := os.ReadFile(deviceLayoutFile)
-	if err != nil || len(b) == 0 {
-		w.deviceToSlot = make(map[int]int)
-		w.ensureMapping()
+	m, ok := readDeviceLayout()
+	w.deviceToSlot = m
+	w.ensureMapping()
+	if !ok {
 		w.saveDeviceLayout()
-		return
+	}
+}
+
+// readDeviceLayout reads the saved device-to-slot mapping. ok is false when
+// the file is missing or unreadable and an empty map is returned.
+func readDeviceLayout() (deviceToSlot map[int]int, ok bool) {
+	deviceToSlot = make(map[int]int)
+	var b []byte
+	err := withDataLock(func() error {
+		var err error
+		b, err = os.ReadFile(deviceLayoutFile)
+		return err
+	})
+	if err != nil || len(b) == 0 {
+		return deviceToSlot, false
 	}
 	type entry struct{ DeviceID, Slot int }
 	var entries []entry
 	if json.Unmarshal(b, &entries) != nil {
-		w.deviceToSlot = make(map[int]int)
-		w.ensureMapping()
-		w.saveDeviceLayout()
-		return
+		return deviceToSlot, false
 	}
-	w.deviceToSlot = make(map[int]int)
 	for _, e := range entries {
-		w.deviceToSlot[e.DeviceID] = e.Slot
+		deviceToSlot[e.DeviceID] = e.Slot
 	}
-	w.ensureMapping()
+	return deviceToSlot, true
 }
 
 func (w *DeviceStatusLayoutWidget) saveDeviceLayout() {
@@ -276,7 +318,35 @@ func (w *DeviceStatusLayoutWidget) saveDeviceLayout() {
 		entries = append(entries, entry{DeviceID: id, Slot: s})
 	}
 	data, _ := json.MarshalIndent(entries, "", "  ")
-	_ = os.WriteFile(deviceLayoutFile, data, 0o644)
+	old, _ := readDeviceLayout()
+	err := withDataLock(func() error { return os.WriteFile(deviceLayoutFile, data, 0o644) })
+
+	// Audit only the devices that moved, as device ID -> slot.
+	before, after := map[int]int{}, map[int]int{}
+	for id, s := range w.deviceToSlot {
+		if prev, ok := old[id]; !ok || prev != s {
+			before[id], after[id] = prev, s
+		}
+	}
+	if len(after) > 0 || err != nil {
+		recordAudit(actingStaff(), auditLayout, "device layout", before, after, err)
+	}
+}
+
+// layoutRows is the floor plan's row structure: the first slots run left to
+// right through these rows and the remaining slots form the side column.
+var layoutRows = []int{3, 3, 3, 3, 4}
+
+// slotRowCol reports where a slot sits in layoutRows; row is -1 for the side
+// column, where col counts down the column.
+func slotRowCol(slot int) (row, col int) {
+	for r, cols := range layoutRows {
+		if slot < cols {
+			return r, slot
+		}
+		slot -= cols
+	}
+	return -1, slot
 }
 
 func (w *DeviceStatusLayoutWidget) computeSlots() {
@@ -288,10 +358,9 @@ func (w *DeviceStatusLayoutWidget) computeSlots() {
 	leftWidth := w.containerSize.Width * 0.85
 	leftX := w.slotMargin
 	topY := w.slotMargin
-	rowHeights := []int{3, 3, 3, 3, 4}
 	placed := 0
-	for r := 0; r < len(rowHeights) && placed < 16 && placed < total; r++ {
-		cols := rowHeights[r]
+	for r := 0; r < len(layoutRows) && placed < 16 && placed < total; r++ {
+		cols := layoutRows[r]
 		rowY := topY + float32(r)*w.slotSpacingY
 		rowWidth := float32(cols-1) * w.slotSpacingX
 		startX := leftX + (leftWidth-rowWidth)/2
@@ -317,7 +386,8 @@ func (w *DeviceStatusLayoutWidget) computeSlots() {
 func (w *DeviceStatusLayoutWidget) UpdateDevices() { w.ensureMapping(); w.Refresh() }
 
 func (w *DeviceStatusLayoutWidget) Tapped(ev *fyne.PointEvent) {
-	for _, d := range allDevices {
+	snap := snapshotState()
+	for _, d := range snap.Devices {
 		center := w.positionForDevice(d.ID)
 		size := w.iconSizeForDevice(d.ID)
 		topLeft := fyne.NewPos(center.X-size/2, center.Y-size/2)
@@ -333,7 +403,7 @@ func (w *DeviceStatusLayoutWidget) Tapped(ev *fyne.PointEvent) {
 			if assignmentNoticeLabel != nil {
 				assignmentNoticeLabel.SetText("")
 			}
-			if err := assignQueuedUserToDevice(target, d.ID); err != nil {
+			if err := assignQueuedUserToDevice(target, d.ID, actingStaff()); err != nil {
 				dialog.ShowError(err, mainWindow)
 			}
 			return
@@ -348,34 +418,58 @@ func (w *DeviceStatusLayoutWidget) Tapped(ev *fyne.PointEvent) {
 			return
 		}
 
+		_, mismatch := occupancyMismatch(d)
 		if d.Status == "occupied" {
-			u := getUserByID(d.UserID)
+			u := snap.user(d.UserID)
 			name := "Unknown User"
 			if u != nil {
 				name = u.Name
 			}
-			dialog.ShowConfirm("Confirm Checkout", fmt.Sprintf("Checkout %s from PC %d?", name, d.ID),
+			msg := fmt.Sprintf("Checkout %s from PC %d?", name, d.ID)
+			if mismatch != "" {
+				msg = mismatch + "\n\n" + msg
+			}
+			dialog.ShowConfirm("Confirm Checkout", msg,
 				func(ok bool) {
 					if ok {
-						if err := checkoutUser(d.UserID); err != nil {
-							dialog.ShowError(err, mainWindow)
-						}
+						checkoutWithEquipment(d.UserID)
 					}
 				}, mainWindow)
 			return
 		}
 
+		if mismatch != "" {
+			showInUseDialog(d.ID, mismatch)
+			return
+		}
 		showCheckInDialogShared(d.ID, true)
 		return
 	}
 }
 
+// showInUseDialog offers to check in whoever is on a free PC, or to lock it.
+func showInUseDialog(deviceID int, detail string) {
+	var dlg dialog.Dialog
+	checkIn := widget.NewButtonWithIcon("Check In...", theme.ContentAddIcon(), func() {
+		dlg.Hide()
+		showCheckInDialogShared(deviceID, true)
+	})
+	checkIn.Importance = widget.HighImportance
+	lock := widget.NewButtonWithIcon("Lock PC", theme.VisibilityOffIcon(), func() {
+		dlg.Hide()
+		reapplyAgent(deviceID)
+	})
+	content := container.NewVBox(widget.NewLabel(detail), container.NewHBox(layout.NewSpacer(), checkIn, lock))
+	dlg = dialog.NewCustom("PC In Use", "Cancel", content, mainWindow)
+	dlg.Show()
+}
+
 func (w *DeviceStatusLayoutWidget) MouseDown(ev *desktop.MouseEvent) {
 	// Right-click on consoles: checkout selection
 	if ev.Button != desktop.MouseButtonSecondary {
 		return
 	}
-	for _, d := range allDevices {
+	for _, d := range snapshotState().Devices {
 		if d.Type != "Console" {
 			continue
 		}
@@ -395,7 +489,7 @@ func (w *DeviceStatusLayoutWidget) MouseUp(_ *desktop.MouseEvent) {}
 
 func (w *DeviceStatusLayoutWidget) Dragged(ev *fyne.DragEvent) {
 	if !w.isDragging {
-		for _, d := range allDevices {
+		for _, d := range snapshotState().Devices {
 			center := w.positionForDevice(d.ID)
 			size := w.iconSizeForDevice(d.ID)
 			topLeft := fyne.NewPos(center.X-size/2, center.Y-size/2)
@@ -442,7 +536,7 @@ func (w *DeviceStatusLayoutWidget) DragEnd() {
 	targetSlot := w.nearestSlot(w.transientDragPos)
 	if targetSlot >= 0 {
 		currentSlot := w.deviceToSlot[w.draggingDeviceID]
-		if currentSlot != targetSlot {
+		if currentSlot != targetSlot && requirePermission(permLayout, "rearrange the floor plan") {
 			otherID := -1
 			for id, s := range w.deviceToSlot {
 				if s == targetSlot {
@@ -522,7 +616,9 @@ func usersOnDevice(deviceID int) []User {
 
 func (r *deviceStatusRenderer) Refresh() {
 	r.objects = r.objects[:0]
-	for _, d := range allDevices {
+	snap := snapshotState()
+	now := time.Now()
+	for _, d := range snap.Devices {
 		center := r.widget.positionForDevice(d.ID)
 		size := r.widget.iconSizeForDevice(d.ID)
 
@@ -540,6 +636,30 @@ func (r *deviceStatusRenderer) Refresh() {
 				base = "console_busy.png"
 			}
 		}
+		if t := snap.reservation(d.ID, now); t != nil {
+			box := canvas.NewRectangle(color.Transparent)
+			box.StrokeColor = theme.PrimaryColor()
+			box.StrokeWidth = 2
+			box.CornerRadius = 6
+			box.Resize(fyne.NewSize(size+8, size+8))
+			box.Move(fyne.NewPos(center.X-size/2-4, center.Y-size/2-4))
+			r.objects = append(r.objects, box)
+			if d.Status == "free" {
+				tag := canvas.NewText(t.Name, theme.PrimaryColor())
+				tag.TextStyle.Bold = true
+				tag.TextSize = 10
+				tag.Move(fyne.NewPos(center.X-tag.MinSize().Width/2, center.Y-size/2-16))
+				r.objects = append(r.objects, tag)
+			}
+		}
+		if alertDevices[d.ID] {
+			ring := canvas.NewCircle(color.Transparent)
+			ring.StrokeColor = theme.ErrorColor()
+			ring.StrokeWidth = 3
+			ring.Resize(fyne.NewSize(size+12, size+12))
+			ring.Move(fyne.NewPos(center.X-size/2-6, center.Y-size/2-6))
+			r.objects = append(r.objects, ring)
+		}
 		imagePath := filepath.Join(imgBaseDir, base)
 		icon := canvas.NewImageFromFile(imagePath)
 		icon.FillMode = canvas.ImageFillContain
@@ -547,17 +667,30 @@ func (r *deviceStatusRenderer) Refresh() {
 		icon.Resize(fyne.NewSize(size, size))
 		icon.Move(fyne.NewPos(center.X-size/2, center.Y-size/2))
 		r.objects = append(r.objects, icon)
+		if c, ok := powerDotColor(d); ok {
+			dot := canvas.NewCircle(c)
+			dot.Resize(fyne.NewSize(12, 12))
+			dot.Move(fyne.NewPos(center.X+size/2-10, center.Y-size/2-2))
+			r.objects = append(r.objects, dot)
+		}
+		if label, _ := occupancyMismatch(d); label != "" {
+			flag := canvas.NewText(label, theme.WarningColor())
+			flag.TextStyle.Bold = true
+			flag.TextSize = 11
+			flag.Move(fyne.NewPos(center.X-flag.MinSize().Width/2, center.Y-size/2-16))
+			r.objects = append(r.objects, flag)
+		}
 
 		// Name(s) under the icon
 		var nameText string
 		if d.Type == "PC" {
 			if d.Status == "occupied" {
-				if u := getUserByID(d.UserID); u != nil {
+				if u := snap.user(d.UserID); u != nil {
 					nameText = firstLast(u.Name)
 				}
 			}
 		} else { // console
-			us := usersOnDevice(d.ID)
+			us := snap.usersOn(d.ID)
 			if len(us) > 0 {
 				names := []string{}
 				for _, u := range us {
@@ -621,12 +754,15 @@ func (w *DeviceStatusLayoutWidget) nearestSlot(p fyne.Position) int {
 
 func ensureLogDir() error { return os.MkdirAll(logDir, 0o755) }
 
-func getLogFilePath() string {
-	return filepath.Join(logDir, fmt.Sprintf("lounge-%s.json", time.Now().Format("2006-01-02")))
+func getLogFilePath() string { return logFilePathForDate(time.Now()) }
+
+func logFilePathForDate(day time.Time) string {
+	return filepath.Join(logDir, fmt.Sprintf("lounge-%s.json", day.Format("2006-01-02")))
 }
 
-func readDailyLogEntries() ([]LogEntry, error) {
-	p := getLogFilePath()
+func readDailyLogEntries() ([]LogEntry, error) { return readLogEntriesFile(getLogFilePath()) }
+
+func readLogEntriesFile(p string) ([]LogEntry, error) {
 	if _, err := os.Stat(p); os.IsNotExist(err) {
 		return []LogEntry{}, nil
 	}
@@ -649,27 +785,36 @@ func readDailyLogEntries() ([]LogEntry, error) {
 }
 
 func writeDailyLogEntries(entries []LogEntry) error {
+	return writeLogEntriesFile(getLogFilePath(), entries)
+}
+
+func writeLogEntriesFile(p string, entries []LogEntry) error {
 	data, err := json.MarshalIndent(entries, "", "  ")
 	if err != nil {
 		return fmt.Errorf("marshal log: %w", err)
 	}
-	return os.WriteFile(getLogFilePath(), data, 0o644)
-}
-
-func recordLogEvent(isCheckIn bool, u User, deviceID int, original *time.Time) {
-	logFileMutex.Lock()
-	defer logFileMutex.Unlock()
-	if err := ensureLogDir(); err != nil {
-		fmt.Println("Error creating log directory:", err)
-		return
+	if err := os.WriteFile(p, data, 0o644); err != nil {
+		return err
 	}
-	entries, err := readDailyLogEntries()
-	if err != nil {
-		fmt.Println("Error reading daily log:", err)
-		return
+	if p == getLogFilePath() {
+		dailyLogStamp = fileStamp(p)
 	}
+	return nil
+}
+
+// recordLogEvent updates the log for the day the session started, so a
+// checkout after midnight still closes yesterday's entry.
+func recordLogEvent(isCheckIn bool, u User, deviceID int, original *time.Time, by string) error {
+	return editSessionLog(u, func(entries []LogEntry) []LogEntry {
+		return applyLogEvent(entries, isCheckIn, u, deviceID, original, by)
+	})
+}
+
+// applyLogEvent appends a check-in entry or closes the matching open one; by
+// is who did it (see actor names in staff.go).
+func applyLogEvent(entries []LogEntry, isCheckIn bool, u User, deviceID int, original *time.Time, by string) []LogEntry {
 	if isCheckIn {
-		entries = append(entries, LogEntry{UserName: u.Name, UserID: u.ID, PCID: deviceID, CheckInTime: u.CheckInTime})
+		entries = append(entries, LogEntry{UserName: u.Name, UserID: u.ID, PCID: deviceID, CheckInTime: u.CheckInTime, CheckInBy: by, Game: u.Game, Tournament: u.Tournament})
 	} else {
 		found := false
 		for i := len(entries) - 1; i >= 0; i-- {
@@ -678,6 +823,9 @@ func recordLogEvent(isCheckIn bool, u User, deviceID int, original *time.Time) {
 				if original == nil || e.CheckInTime.Equal(*original) {
 					entries[i].CheckOutTime = time.Now()
 					entries[i].UsageTime = formatDuration(entries[i].CheckOutTime.Sub(entries[i].CheckInTime))
+					entries[i].CheckOutBy = by
+					entries[i].AutoClosed = by == actorClosing
+					closeLastSegment(&entries[i])
 					found = true
 					break
 				}
@@ -687,19 +835,102 @@ func recordLogEvent(isCheckIn bool, u User, deviceID int, original *time.Time) {
 			fmt.Printf("No matching check-in for user %s (ID: %s) Device %d.\n", u.Name, u.ID, deviceID)
 		}
 	}
-	if err := writeDailyLogEntries(entries); err != nil {
-		fmt.Println("Error writing daily log:", err)
+	return entries
+}
+
+// logEventAsync records a log event off the UI thread.
+func logEventAsync(isCheckIn bool, u User, deviceID int, original *time.Time, by string) {
+	queueLogWrite(func() error { return recordLogEvent(isCheckIn, u, deviceID, original, by) })
+}
+
+// ---------- Log writer ----------
+//
+// Every change to the daily logs is queued holding the state lock and
+// written by a single goroutine in that order, so a checkout never reaches
+// the file before its check-in. Queued writes must not take the state lock.
+
+var (
+	logQueueMu   sync.Mutex
+	logQueueIdle = sync.NewCond(&logQueueMu)
+	logQueue     []func() error
+	logWriting   bool
+)
+
+// queueLogWrite hands a log change to the writer; call holding the state
+// lock. Headless callers flush before exiting so no entry is lost, and undo
+// flushes before it starts (see lockSettled).
+func queueLogWrite(write func() error) {
+	logQueueMu.Lock()
+	defer logQueueMu.Unlock()
+	logQueue = append(logQueue, write)
+	if !logWriting {
+		logWriting = true
+		go runLogWriter()
+	}
+}
+
+// runLogWriter writes the queue in order until it is empty. A failed write
+// is reported and the ones after it still run.
+func runLogWriter() {
+	logQueueMu.Lock()
+	for len(logQueue) > 0 {
+		write := logQueue[0]
+		logQueue = logQueue[1:]
+		logQueueMu.Unlock()
+		if err := write(); err != nil {
+			reportLogError(err)
+		}
+		logQueueMu.Lock()
+	}
+	logWriting = false
+	logQueueIdle.Broadcast()
+	logQueueMu.Unlock()
+}
+
+// reportLogError tells staff that a change is in the state but not in the
+// log, which then needs fixing by hand.
+func reportLogError(err error) {
+	fmt.Println("Error updating daily log:", err)
+	if headless || mainWindow == nil {
+		return
+	}
+	fyne.Do(func() {
+		dialog.ShowError(fmt.Errorf("the daily log was not updated: %w", err), mainWindow)
+	})
+}
+
+// flushLogWrites waits until every queued log change is written. Called
+// holding the state lock, nothing can be queued after it returns.
+func flushLogWrites() {
+	logQueueMu.Lock()
+	defer logQueueMu.Unlock()
+	for logWriting {
+		logQueueIdle.Wait()
+	}
+}
+
+// showLogEntries hands a freshly written daily log to the log table.
+// currentLogEntries belongs to the Fyne thread, so it is only set there.
+func showLogEntries(entries []LogEntry) {
+	if headless {
+		return
 	}
 	fyne.Do(func() {
 		currentLogEntries = entries
-		if logTable != nil {
-			logTable.Refresh()
-		} else {
-			logRefreshPending = true
-		}
+		notifyLocal(LoungeEvent{Type: EventLogUpdated})
 	})
 }
 
+// runOnUI hands fn to the Fyne event loop, or runs it directly when there is
+// no window (command-line mode).
+func runOnUI(fn func()) {
+	if headless {
+		fn()
+		return
+	}
+	fyne.Do(fn)
+}
+
 func formatDuration(d time.Duration) string {
 	d = d.Round(time.Second)
 	h := int(d.Hours())
@@ -715,7 +946,7 @@ func formatDuration(d time.Duration) string {
 }
 
 func updateCurrentLogEntriesCache() {
-	entries, err := readDailyLogEntries()
+	entries, err := readLogEntriesLocked(getLogFilePath())
 	if err != nil {
 		fmt.Println("Error updating log cache:", err)
 		currentLogEntries = []LogEntry{}
@@ -727,7 +958,7 @@ func updateCurrentLogEntriesCache() {
 func buildLogView() fyne.CanvasObject {
 	updateCurrentLogEntriesCache()
 	logTable = widget.NewTable(
-		func() (int, int) { return len(currentLogEntries) + 1, 6 },
+		func() (int, int) { return len(currentLogEntries) + 1, 9 },
 		func() fyne.CanvasObject { return widget.NewLabel("") },
 		func(id widget.TableCellID, o fyne.CanvasObject) {
 			l := o.(*widget.Label)
@@ -741,11 +972,17 @@ func buildLogView() fyne.CanvasObject {
 				case 2:
 					l.SetText("Device ID")
 				case 3:
-					l.SetText("Checked In")
+					l.SetText("Game")
 				case 4:
-					l.SetText("Checked Out")
+					l.SetText("Checked In")
 				case 5:
+					l.SetText("Checked Out")
+				case 6:
 					l.SetText("Usage Time")
+				case 7:
+					l.SetText("In By")
+				case 8:
+					l.SetText("Out By")
 				}
 				return
 			}
@@ -757,26 +994,39 @@ func buildLogView() fyne.CanvasObject {
 			case 1:
 				l.SetText(e.UserID)
 			case 2:
-				l.SetText(strconv.Itoa(e.PCID))
+				l.SetText(e.deviceRoute())
 			case 3:
-				l.SetText(e.CheckInTime.Format("15:04:05 (Jan 02)"))
+				l.SetText(e.Game)
 			case 4:
+				l.SetText(e.CheckInTime.Format("15:04:05 (Jan 02)"))
+			case 5:
 				if e.CheckOutTime.IsZero() {
 					l.SetText("-")
 				} else {
 					l.SetText(e.CheckOutTime.Format("15:04:05 (Jan 02)"))
 				}
-			case 5:
-				l.SetText(e.UsageTime)
+			case 6:
+				if e.AutoClosed {
+					l.SetText(e.UsageTime + " (auto-closed)")
+				} else {
+					l.SetText(e.UsageTime)
+				}
+			case 7:
+				l.SetText(e.CheckInBy)
+			case 8:
+				l.SetText(e.CheckOutBy)
 			}
 		},
 	)
 	logTable.SetColumnWidth(0, 180)
 	logTable.SetColumnWidth(1, 100)
 	logTable.SetColumnWidth(2, 70)
-	logTable.SetColumnWidth(3, 150)
+	logTable.SetColumnWidth(3, 140)
 	logTable.SetColumnWidth(4, 150)
-	logTable.SetColumnWidth(5, 120)
+	logTable.SetColumnWidth(5, 150)
+	logTable.SetColumnWidth(6, 170)
+	logTable.SetColumnWidth(7, 90)
+	logTable.SetColumnWidth(8, 90)
 	return container.NewScroll(logTable)
 }
 
@@ -862,8 +1112,10 @@ func buildInlineCheckInForm() *fyne.Container {
 
 	checkInSearchEntry.OnChanged = func(q string) {
 		q = strings.ToLower(strings.TrimSpace(q))
-		if len(members) == 0 {
+		all := snapshotMembers()
+		if len(all) == 0 {
 			loadMembers()
+			all = snapshotMembers()
 		}
 		if q == "" {
 			filteredMembersForInline = nil
@@ -872,7 +1124,7 @@ func buildInlineCheckInForm() *fyne.Container {
 			return
 		}
 		matches := make([]Member, 0, 20)
-		for _, m := range members {
+		for _, m := range all {
 			n := strings.ToLower(strings.TrimSpace(m.Name))
 			id := strings.ToLower(strings.TrimSpace(m.ID))
 			if strings.Contains(n, q) || strings.Contains(id, q) {
@@ -888,6 +1140,9 @@ func buildInlineCheckInForm() *fyne.Container {
 		}
 	}
 
+	wantSelect := widget.NewSelect(append([]string{anyDeviceType}, snapshotState().deviceTypes()...), nil)
+	wantSelect.SetSelected(anyDeviceType)
+
 	noIDButton := widget.NewButton("No ID?", func() {
 		checkInIDEntry.SetText("LOUNGE-" + getNextMemberID())
 	})
@@ -898,15 +1153,22 @@ func buildInlineCheckInForm() *fyne.Container {
 			dialog.ShowError(fmt.Errorf("name and ID are required"), mainWindow)
 			return
 		}
-		if err := registerUser(name, id, 0); err != nil {
-			dialog.ShowError(err, mainWindow)
-			return
+		clear := func() {
+			checkInNameEntry.SetText("")
+			checkInIDEntry.SetText("")
+			wantSelect.SetSelected(anyDeviceType)
+		}
+		wantType := wantSelect.Selected
+		if wantType == anyDeviceType {
+			wantType = ""
 		}
-		checkInNameEntry.SetText("")
-		checkInIDEntry.SetText("")
-		if pendingIconsBox != nil {
-			refreshPendingIcons()
+		if err := queueUser(name, id, wantType, actingStaff()); err != nil {
+			if !offerAfterHours(err, func() error { return registerUserHours(name, id, 0, "", "", wantType, actingStaff(), true) }, clear) {
+				dialog.ShowError(err, mainWindow)
+			}
+			return
 		}
+		clear()
 	})
 	hideButton := widget.NewButton("Hide", func() {
 		if checkInInlineForm != nil {
@@ -919,6 +1181,7 @@ func buildInlineCheckInForm() *fyne.Container {
 	form := widget.NewForm(
 		widget.NewFormItem("Name", checkInNameEntry),
 		widget.NewFormItem("ID", idRow),
+		widget.NewFormItem("Wants", wantSelect),
 	)
 
 	header := widget.NewLabelWithStyle("Queue Check-In", fyne.TextAlignLeading, fyne.TextStyle{Bold: true})
@@ -929,6 +1192,16 @@ func buildInlineCheckInForm() *fyne.Container {
 	return wrapper
 }
 
+// anyDeviceType is the "Wants" choice for a user who takes any device.
+const anyDeviceType = "Any"
+
+// queueUser adds a user to the check-in queue without a device; shared by the
+// inline form and the kiosk. wantType is the device type they wait for, or
+// "" for any.
+func queueUser(name, id, wantType, by string) error {
+	return registerUserHours(name, id, 0, "", "", wantType, by, false)
+}
+
 func buildPendingQueueView() fyne.CanvasObject {
 	assignmentNoticeLabel = widget.NewLabel("")
 	pendingIconsBox = container.NewHBox()
@@ -944,19 +1217,33 @@ func buildPendingQueueView() fyne.CanvasObject {
 // ---------- Members CSV ----------
 
 func loadMembers() {
-	f, err := os.Open(memberFile)
+	var parsed []Member
+	err := withDataLock(func() error {
+		f, err := os.Open(memberFile)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		parsed, err = parseMembersCSV(f)
+		return err
+	})
 	if err != nil {
-		members = nil
-		return
+		parsed = nil
 	}
-	defer f.Close()
+	withState(func() { members = parsed })
+}
 
-	r := csv.NewReader(f)
+// parseMembersCSV reads members from a CSV, using a Name/ID header when one
+// is present and falling back to the membership.csv column layout otherwise.
+func parseMembersCSV(in io.Reader) ([]Member, error) {
+	r := csv.NewReader(in)
 	r.FieldsPerRecord = -1
 	rows, err := r.ReadAll()
-	if err != nil || len(rows) == 0 {
-		members = nil
-		return
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil
 	}
 
 	nameIdx, idIdx := -1, -1
@@ -978,7 +1265,7 @@ func loadMembers() {
 		nameIdx, idIdx = 2, 3
 	}
 
-	members = members[:0]
+	out := []Member{}
 	for _, row := range rows[start:] {
 		if nameIdx >= len(row) || idIdx >= len(row) {
 			continue
@@ -988,53 +1275,58 @@ func loadMembers() {
 		if name == "" || id == "" {
 			continue
 		}
-		members = append(members, Member{
+		out = append(out, Member{
 			Name:          name,
 			ID:            id,
 			StudentNumber: id,
 		})
 	}
+	return out, nil
 }
 
-func getNextMemberID() string { return strconv.Itoa(len(members) + 1) }
+func getNextMemberID() string { return strconv.Itoa(len(snapshotMembers()) + 1) }
 
-func appendMember(m Member) {
-	f, err := os.OpenFile(memberFile, os.O_RDWR|os.O_CREATE, 0o644)
-	if err != nil {
-		fmt.Println("Error opening member file:", err)
-		return
-	}
-	defer f.Close()
+// appendMember adds m to the member file. Call holding the state lock.
+func appendMember(m Member, by string) {
+	err := withDataLock(func() error {
+		f, err := os.OpenFile(memberFile, os.O_RDWR|os.O_CREATE, 0o644)
+		if err != nil {
+			return fmt.Errorf("open member file: %w", err)
+		}
+		defer f.Close()
 
-	r := csv.NewReader(f)
-	rows, readErr := r.ReadAll()
-	if readErr != nil && readErr != io.EOF {
-		fmt.Println("Error reading CSV:", readErr)
-		return
-	}
+		r := csv.NewReader(f)
+		r.FieldsPerRecord = -1
+		rows, readErr := r.ReadAll()
+		if readErr != nil && readErr != io.EOF {
+			return fmt.Errorf("read CSV: %w", readErr)
+		}
 
-	f.Seek(0, 0)
-	f.Truncate(0)
+		f.Seek(0, 0)
+		f.Truncate(0)
 
-	w := csv.NewWriter(f)
-	for _, row := range rows {
-		if err := w.Write(row); err != nil {
-			fmt.Println("Error writing row:", err)
-			return
+		w := csv.NewWriter(f)
+		for _, row := range rows {
+			if err := w.Write(row); err != nil {
+				return fmt.Errorf("write row: %w", err)
+			}
 		}
-	}
-	newRow := []string{"", "", m.Name, m.ID}
-	if err := w.Write(newRow); err != nil {
-		fmt.Println("Error writing new member:", err)
+		newRow := []string{"", "", m.Name, m.ID}
+		if err := w.Write(newRow); err != nil {
+			return fmt.Errorf("write new member: %w", err)
+		}
+		w.Flush()
+		return w.Error()
+	})
+	recordAudit(by, auditMemberAdd, m.ID, nil, m, err)
+	if err != nil {
+		fmt.Println("Error appending member:", err)
 		return
 	}
-	w.Flush()
-	if err := w.Error(); err != nil {
-		fmt.Println("Error flushing writer:", err)
-	}
 	members = append(members, m)
 }
 
+// memberByID must run holding the state lock; views use snapshotMembers.
 func memberByID(id string) *Member {
 	for i := range members {
 		if members[i].ID == id {
@@ -1044,10 +1336,31 @@ func memberByID(id string) *Member {
 	return nil
 }
 
+// resolveMemberName returns name, or the member record's name when name is
+// empty, so scripted check-ins only need an ID for known members.
+func resolveMemberName(id, name string) (string, error) {
+	if n := strings.TrimSpace(name); n != "" {
+		return n, nil
+	}
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	m := memberByID(strings.TrimSpace(id))
+	if m == nil {
+		return "", fmt.Errorf("user ID %s is not a member; a name is required to register them", id)
+	}
+	return m.Name, nil
+}
+
 // ---------- Data init & helpers ----------
 
+// initData loads the state. It takes the state lock like any other writer:
+// tests run it again while goroutines from earlier ones may still read.
 func initData() {
 	ensureLogDir()
+	if err := loadConfig(); err != nil {
+		fmt.Println("Error loading config:", err)
+	}
+	stateMu.Lock()
 	allDevices = []Device{}
 	for i := 1; i <= 16; i++ {
 		allDevices = append(allDevices, Device{ID: i, Type: "PC", Status: "free", UserID: ""})
@@ -1056,43 +1369,26 @@ func initData() {
 	allDevices = append(allDevices, Device{ID: 18, Type: "Console", Status: "free", UserID: ""})
 
 	activeUsers = []User{}
-	if _, err := os.Stat(userDataFile); !os.IsNotExist(err) {
-		if f, e := os.Open(userDataFile); e == nil {
-			defer f.Close()
-			if json.NewDecoder(f).Decode(&activeUsers) == nil {
-				for i := range activeUsers {
-					u := &activeUsers[i]
-					for j := range allDevices {
-						if allDevices[j].ID == u.PCID {
-							allDevices[j].Status = "occupied"
-							if allDevices[j].Type == "PC" {
-								allDevices[j].UserID = u.ID
-							}
-							break
-						}
-					}
-				}
-			} else {
-				activeUsers = []User{}
-			}
-		}
+	if err := withDataLock(loadUserData); err != nil {
+		fmt.Println("Error loading user data:", err)
+	}
+	if _, err := loadTournaments(); err != nil {
+		fmt.Println("Error loading events:", err)
 	}
+	stateMu.Unlock()
 	loadMembers()
 }
 
+// saveData writes activeUsers. Call holding the state lock.
 func saveData() {
-	ensureLogDir()
-	f, err := os.Create(userDataFile)
-	if err != nil {
-		fmt.Println("Error creating user data file:", err)
-		return
-	}
-	defer f.Close()
-	if err := json.NewEncoder(f).Encode(activeUsers); err != nil {
-		fmt.Println("Error encoding user data:", err)
+	if err := withDataLock(writeUserData); err != nil {
+		fmt.Println("Error saving user data:", err)
 	}
 }
 
+// The lookups below return pointers into the live state and must run
+// holding the state lock; views use a stateSnapshot instead.
+
 func getUserByID(id string) *User {
 	for i := range activeUsers {
 		if activeUsers[i].ID == id {
@@ -1121,21 +1417,102 @@ func activeUserIDsOnDevice(deviceID int) []string {
 	return ids
 }
 
-func registerUser(name, userID string, deviceID int) error {
-	if getUserByID(userID) != nil {
-		existing := getUserByID(userID)
+// registerUser checks a user in to deviceID, or queues them when it is 0. by
+// names who did it for the log (see staff.go). game is optional and must be
+// installed on the device. Outside opening hours it fails with
+// errLoungeClosed.
+func registerUser(name, userID string, deviceID int, game, by string) error {
+	return registerUserHours(name, userID, deviceID, game, "", "", by, false)
+}
+
+// registerUserAfterHours is registerUser for a check-in staff have agreed to
+// let in while the lounge is closed.
+func registerUserAfterHours(name, userID string, deviceID int, game, by string) error {
+	return registerUserHours(name, userID, deviceID, game, "", "", by, true)
+}
+
+// registerUserHours is the full check-in: tournamentID names the running
+// event a participant plays in (see tournaments.go), wantType the device type
+// a queued user waits for, and afterHours lets it through while the lounge is
+// closed.
+func registerUserHours(name, userID string, deviceID int, game, tournamentID, wantType, by string, afterHours bool) (err error) {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	action := EventCheckIn
+	if deviceID == 0 {
+		action = EventQueueJoin
+	}
+	defer auditUserChange(by, action, userID, userCopy(userID), &err)
+	if closed := checkOpen(time.Now()); closed != nil {
+		if !afterHours {
+			return closed
+		}
+		recordAudit(by, auditAfterHours, userID, nil, map[string]any{"name": name, "device": deviceID}, nil)
+	}
+	if err = checkGame(deviceID, game); err != nil {
+		return err
+	}
+	if err = checkReservationLocked(deviceID, tournamentID, time.Now()); err != nil {
+		return err
+	}
+	if wantType, err = checkWantTypeLocked(deviceID, wantType); err != nil {
+		return err
+	}
+	if err = registerUserLocked(name, userID, deviceID, game, tournamentID, wantType, by); err != nil {
+		return err
+	}
+	idx := indexOfUser(activeUsers, userID)
+	label := fmt.Sprintf("check-in of %s to %s", name, deviceName(deviceID))
+	if deviceID == 0 {
+		label = fmt.Sprintf("queueing %s", name)
+	}
+	recordUndo(undoOp{Label: label, By: by, Steps: []undoStep{{Kind: undoStepAdd, After: activeUsers[idx], Index: idx}}})
+	return nil
+}
+
+// checkRegisterLocked reports why userID cannot be checked in on deviceID;
+// registerUserLocked fails for no other reason.
+func checkRegisterLocked(userID string, deviceID int) error {
+	if existing := getUserByID(userID); existing != nil {
 		return fmt.Errorf("user ID %s (%s) already checked in on Device %d", userID, existing.Name, existing.PCID)
 	}
+	if deviceID == 0 {
+		return nil
+	}
+	device := getDeviceByID(deviceID)
+	if device == nil {
+		return fmt.Errorf("device ID %d does not exist", deviceID)
+	}
+	if device.Type == "PC" && device.Status != "free" {
+		return fmt.Errorf("device %d is busy (occupied by UserID: %s)", deviceID, device.UserID)
+	}
+	return nil
+}
+
+// checkWantTypeLocked returns the device type a user joining the queue asked
+// for, spelled as the lounge's devices spell it. It is "" for any device and
+// for a check-in straight onto a device.
+func checkWantTypeLocked(deviceID int, want string) (string, error) {
+	want = strings.TrimSpace(want)
+	if want == "" || deviceID != 0 {
+		return "", nil
+	}
+	for _, d := range allDevices {
+		if strings.EqualFold(d.Type, want) {
+			return d.Type, nil
+		}
+	}
+	return "", fmt.Errorf("there are no %s devices to wait for", want)
+}
+
+func registerUserLocked(name, userID string, deviceID int, game, tournamentID, wantType, by string) error {
+	if err := checkRegisterLocked(userID, deviceID); err != nil {
+		return err
+	}
 
 	if deviceID != 0 {
 		device := getDeviceByID(deviceID)
-		if device == nil {
-			return fmt.Errorf("device ID %d does not exist", deviceID)
-		}
 		if device.Type == "PC" {
-			if device.Status != "free" {
-				return fmt.Errorf("device %d is busy (occupied by UserID: %s)", deviceID, device.UserID)
-			}
 			device.Status = "occupied"
 			device.UserID = userID
 		} else {
@@ -1143,22 +1520,52 @@ func registerUser(name, userID string, deviceID int) error {
 		}
 	}
 
-	newUser := User{ID: userID, Name: name, CheckInTime: time.Now(), PCID: deviceID}
+	newUser := User{ID: userID, Name: name, CheckInTime: time.Now(), PCID: deviceID, Game: game, Tournament: tournamentID, WantType: wantType}
 	activeUsers = append(activeUsers, newUser)
 
 	if memberByID(userID) == nil {
-		appendMember(Member{Name: name, ID: userID})
+		appendMember(Member{Name: name, ID: userID}, by)
 	}
 	saveData()
-	go recordLogEvent(true, newUser, deviceID, nil)
-	refreshTrigger <- true
+	logEventAsync(true, newUser, deviceID, nil, by)
+	evType := EventCheckIn
+	if deviceID == 0 {
+		evType = EventQueueJoin
+	}
+	publishEvent(LoungeEvent{Type: evType, UserID: userID, UserName: name, DeviceID: deviceID})
 	return nil
 }
 
-func checkoutUser(userID string) error {
+// checkoutUser checks a user out and returns the items they still have, so
+// every front end can remind them.
+func checkoutUser(userID, by string) (loans []Loan, err error) {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	action := EventCheckOut
+	if u := getUserByID(userID); u != nil && u.PCID == 0 {
+		action = EventQueueLeave
+	}
+	defer auditUserChange(by, action, userID, userCopy(userID), &err)
+	idx := indexOfUser(activeUsers, userID)
+	if idx < 0 {
+		return nil, fmt.Errorf("user ID %s not found", userID)
+	}
+	before := activeUsers[idx]
+	if loans, err = checkoutUserLocked(userID, by); err != nil {
+		return nil, err
+	}
+	recordUndo(undoOp{
+		Label: fmt.Sprintf("checkout of %s from %s", before.Name, deviceName(before.PCID)),
+		By:    by,
+		Steps: []undoStep{{Kind: undoStepRemove, Before: before, Index: idx, ClosedAt: time.Now()}},
+	})
+	return loans, nil
+}
+
+func checkoutUserLocked(userID, by string) ([]Loan, error) {
 	u := getUserByID(userID)
 	if u == nil {
-		return fmt.Errorf("user ID %s not found", userID)
+		return nil, fmt.Errorf("user ID %s not found", userID)
 	}
 	idx := -1
 	for i, v := range activeUsers {
@@ -1168,40 +1575,41 @@ func checkoutUser(userID string) error {
 		}
 	}
 	if idx == -1 {
-		return fmt.Errorf("user %s consistency error", userID)
+		return nil, fmt.Errorf("user %s consistency error", userID)
 	}
-	originalCheckIn := u.CheckInTime
-	devID := u.PCID
-	dev := getDeviceByID(devID)
+	user := *u // u points into activeUsers, which is about to shift
+	originalCheckIn := user.CheckInTime
+	devID := user.PCID
 
 	activeUsers = append(activeUsers[:idx], activeUsers[idx+1:]...)
-
-	if dev != nil {
-		if dev.Type == "PC" {
-			dev.Status = "free"
-			dev.UserID = ""
-		} else {
-			if len(activeUserIDsOnDevice(dev.ID)) == 0 {
-				dev.Status = "free"
-			} else {
-				dev.Status = "occupied"
-			}
-		}
-	}
+	freed := releaseDevice(devID)
 
 	saveData()
-	go recordLogEvent(false, *u, devID, &originalCheckIn)
-	refreshTrigger <- true
-	return nil
+	logEventAsync(false, user, devID, &originalCheckIn, by)
+	evType := EventCheckOut
+	if devID == 0 {
+		evType = EventQueueLeave
+	}
+	loans := loansOutTo(user.ID)
+	publishEvent(LoungeEvent{Type: evType, UserID: user.ID, UserName: user.Name, DeviceID: devID, Message: borrowedNote(loans)})
+	if freed {
+		publishEvent(LoungeEvent{Type: EventDeviceFreed, DeviceID: devID})
+	}
+	return loans, nil
 }
 
-func removeQueuedUser(userID string) error {
+// removeQueuedUser takes a user out of the queue and, like checkoutUser,
+// returns the items they still have.
+func removeQueuedUser(userID, by string) (loans []Loan, err error) {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	defer auditUserChange(by, EventQueueLeave, userID, userCopy(userID), &err)
 	u := getUserByID(userID)
 	if u == nil {
-		return fmt.Errorf("user ID %s not found", userID)
+		return nil, fmt.Errorf("user ID %s not found", userID)
 	}
 	if u.PCID != 0 {
-		return fmt.Errorf("user %s is assigned to device %d", userID, u.PCID)
+		return nil, fmt.Errorf("user %s is assigned to device %d", userID, u.PCID)
 	}
 	idx := -1
 	for i := range activeUsers {
@@ -1211,17 +1619,42 @@ func removeQueuedUser(userID string) error {
 		}
 	}
 	if idx == -1 {
-		return fmt.Errorf("user %s consistency error", userID)
+		return nil, fmt.Errorf("user %s consistency error", userID)
 	}
-	original := u.CheckInTime
+	user := *u
+	original := user.CheckInTime
 	activeUsers = append(activeUsers[:idx], activeUsers[idx+1:]...)
 	saveData()
-	go recordLogEvent(false, *u, 0, &original)
-	refreshTrigger <- true
+	logEventAsync(false, user, 0, &original, by)
+	recordUndo(undoOp{
+		Label: fmt.Sprintf("removing %s from the queue", user.Name),
+		By:    by,
+		Steps: []undoStep{{Kind: undoStepRemove, Before: user, Index: idx, ClosedAt: time.Now()}},
+	})
+	loans = loansOutTo(user.ID)
+	publishEvent(LoungeEvent{Type: EventQueueLeave, UserID: user.ID, UserName: user.Name, Message: borrowedNote(loans)})
+	return loans, nil
+}
+
+func assignQueuedUserToDevice(userID string, deviceID int, by string) (err error) {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	defer auditUserChange(by, EventAssign, userID, userCopy(userID), &err)
+	step, err := assignQueuedUserLocked(userID, deviceID)
+	if err != nil {
+		return err
+	}
+	recordUndo(undoOp{
+		Label: fmt.Sprintf("assignment of %s to %s", step.After.Name, deviceName(deviceID)),
+		By:    by,
+		Steps: []undoStep{step},
+	})
 	return nil
 }
 
-func assignQueuedUserToDevice(userID string, deviceID int) error {
+// checkAssignLocked reports why the queued userID cannot be assigned to
+// deviceID; assignQueuedUserLocked fails for no other reason.
+func checkAssignLocked(userID string, deviceID int, now time.Time) error {
 	u := getUserByID(userID)
 	if u == nil {
 		return fmt.Errorf("user ID %s not found", userID)
@@ -1236,88 +1669,90 @@ func assignQueuedUserToDevice(userID string, deviceID int) error {
 	if d.Type == "PC" && d.Status != "free" {
 		return fmt.Errorf("device %d is busy", deviceID)
 	}
+	return checkReservationLocked(deviceID, "", now)
+}
+
+// assignQueuedUserLocked moves a queued user onto a device and returns the
+// undo step for the move.
+func assignQueuedUserLocked(userID string, deviceID int) (undoStep, error) {
+	if err := checkAssignLocked(userID, deviceID, time.Now()); err != nil {
+		return undoStep{}, err
+	}
+	u := getUserByID(userID)
+	d := getDeviceByID(deviceID)
 	d.Status = "occupied"
 	if d.Type == "PC" {
 		d.UserID = userID
 	}
 	original := u.CheckInTime
-	u.PCID = deviceID
+	name := u.Name
+	before := *u
+	u.PCID, u.WantType = deviceID, ""
+	if checkGame(deviceID, u.Game) != nil {
+		u.Game = "" // picked in the queue but not installed here
+	}
+	game := u.Game
+	step := undoStep{Kind: undoStepMove, Before: before, After: *u}
 	saveData()
 
-	logFileMutex.Lock()
-	entries, err := readDailyLogEntries()
-	if err == nil {
-		for i := len(entries) - 1; i >= 0; i-- {
-			if entries[i].UserID == userID && entries[i].CheckOutTime.IsZero() &&
-				entries[i].PCID == 0 && entries[i].CheckInTime.Equal(original) {
-				entries[i].PCID = deviceID
-				break
+	// The entry is in the log of the day they joined the queue, queued behind
+	// the check-in that created it.
+	queueLogWrite(func() error {
+		return editSessionLog(before, func(entries []LogEntry) []LogEntry {
+			for i := len(entries) - 1; i >= 0; i-- {
+				if entries[i].UserID == userID && entries[i].CheckOutTime.IsZero() &&
+					entries[i].PCID == 0 && entries[i].CheckInTime.Equal(original) {
+					entries[i].PCID = deviceID
+					entries[i].Game = game
+					break
+				}
 			}
-		}
-		_ = writeDailyLogEntries(entries)
-		currentLogEntries = entries
-	}
-	logFileMutex.Unlock()
+			return entries
+		})
+	})
 
-	refreshTrigger <- true
-	return nil
+	publishEvent(LoungeEvent{Type: EventAssign, UserID: userID, UserName: name, DeviceID: deviceID})
+	return step, nil
 }
 
-func switchUserStation(userID string, newDeviceID int) error {
-	u := getUserByID(userID)
-	if u == nil {
-		return fmt.Errorf("user ID %s not found", userID)
-	}
-	if u.PCID == 0 {
-		return fmt.Errorf("user %s is in queue, use assign instead", userID)
-	}
-
-	oldDeviceID := u.PCID
-	if oldDeviceID == newDeviceID {
-		return fmt.Errorf("user is already on device %d", newDeviceID)
-	}
-
-	newDevice := getDeviceByID(newDeviceID)
-	if newDevice == nil {
-		return fmt.Errorf("target device ID %d does not exist", newDeviceID)
+// switchUserStation moves a checked-in user to another device. The session
+// carries on: it keeps its check-in time and log entry, which gains a
+// segment for the new device.
+func switchUserStation(userID string, newDeviceID int, by string) (err error) {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	defer auditUserChange(by, EventSwitch, userID, userCopy(userID), &err)
+	step, err := moveUserLocked(userID, newDeviceID, by, time.Now())
+	if err != nil {
+		return err
 	}
+	recordUndo(undoOp{
+		Label: fmt.Sprintf("switch of %s from %s to %s", step.Before.Name, deviceName(step.Before.PCID), deviceName(newDeviceID)),
+		By:    by,
+		Steps: []undoStep{step},
+	})
+	return nil
+}
 
-	// Check if new device is available
-	if newDevice.Type == "PC" && newDevice.Status != "free" {
-		return fmt.Errorf("device %d is busy (occupied by UserID: %s)", newDeviceID, newDevice.UserID)
+// userCopy returns a copy of the active user, or nil. Call holding the state
+// lock.
+func userCopy(id string) *User {
+	if u := getUserByID(id); u != nil {
+		cp := *u
+		return &cp
 	}
+	return nil
+}
 
-	// Store user info before checkout
-	userName := u.Name
-	userID_copy := u.ID
-
-	// Step 1: Check out from old device
-	// This will:
-	// - Record checkout time in log
-	// - Calculate usage time for old device
-	// - Free up the old device
-	// - Remove user from activeUsers
-	if err := checkoutUser(userID); err != nil {
-		return fmt.Errorf("failed to checkout from device %d: %w", oldDeviceID, err)
+// auditUserChange records an operation on userID with the user's record
+// before it and, if it succeeded, after it. It is deferred by the mutations,
+// so it reads *err once they return.
+func auditUserChange(by, action, userID string, before *User, err *error) {
+	var after *User
+	if *err == nil {
+		after = userCopy(userID)
 	}
-
-	// Step 2: Check in to new device
-	// This will:
-	// - Record new check-in time in log
-	// - Occupy the new device
-	// - Add user back to activeUsers with new device
-	if err := registerUser(userName, userID_copy, newDeviceID); err != nil {
-		// If check-in fails, try to restore user to original device
-		// This is a rollback attempt
-		restoreErr := registerUser(userName, userID_copy, oldDeviceID)
-		if restoreErr != nil {
-			return fmt.Errorf("switch failed and rollback failed - user may be in inconsistent state: original error: %w, rollback error: %v", err, restoreErr)
-		}
-		return fmt.Errorf("failed to check in to device %d (restored to device %d): %w", newDeviceID, oldDeviceID, err)
-	}
-
-	refreshTrigger <- true
-	return nil
+	recordAudit(by, action, userID, before, after, *err)
 }
 
 func getPendingUsers() []User {
@@ -1333,18 +1768,15 @@ func getPendingUsers() []User {
 // ---------- Console checkout selection ----------
 
 func showConsoleCheckoutDialog(d Device) {
-	userIDs := activeUserIDsOnDevice(d.ID)
-	if len(userIDs) == 0 {
+	users := snapshotState().usersOn(d.ID)
+	if len(users) == 0 {
 		return
 	}
-	display := make([]string, 0, len(userIDs))
-	for _, id := range userIDs {
-		u := getUserByID(id)
-		name := "Unknown User"
-		if u != nil {
-			name = u.Name
-		}
-		display = append(display, fmt.Sprintf("%s (ID: %s)", name, id))
+	display := make([]string, 0, len(users))
+	userIDs := make([]string, 0, len(users))
+	for _, u := range users {
+		display = append(display, fmt.Sprintf("%s (ID: %s)", u.Name, u.ID))
+		userIDs = append(userIDs, u.ID)
 	}
 	selector := widget.NewSelectEntry(display)
 	items := []*widget.FormItem{{Text: "User on " + d.Type, Widget: selector}}
@@ -1366,9 +1798,7 @@ func showConsoleCheckoutDialog(d Device) {
 		if targetID == "" {
 			return
 		}
-		if err := checkoutUser(targetID); err != nil {
-			dialog.ShowError(err, mainWindow)
-		}
+		checkoutWithEquipment(targetID)
 	}, mainWindow)
 	dlg.Resize(fyne.NewSize(420, dlg.MinSize().Height))
 	dlg.Show()
@@ -1378,8 +1808,8 @@ func showConsoleCheckoutDialog(d Device) {
 
 func buildDeviceRoomContent() fyne.CanvasObject {
 	// device area (right)
-	layoutWidget := NewDeviceStatusLayoutWidget()
-	layoutWidget.UpdateDevices()
+	deviceLayout = NewDeviceStatusLayoutWidget()
+	deviceLayout.UpdateDevices()
 
 	// left column: queue check-in + queued icons
 	checkInInlineForm = buildInlineCheckInForm() // keep visible
@@ -1395,7 +1825,7 @@ func buildDeviceRoomContent() fyne.CanvasObject {
 	leftScroll.SetMinSize(fyne.NewSize(340, 0))
 
 	// side-by-side: left column (check-in) and right (PC layout)
-	split := container.NewHSplit(leftScroll, layoutWidget)
+	split := container.NewHSplit(leftScroll, deviceLayout)
 	split.Offset = 0.30 // ~30% left column
 
 	return split
@@ -1470,7 +1900,7 @@ func showCheckInDialogShared(deviceID int, fixed bool) {
 			filtered = []Member{}
 		} else {
 			out := []Member{}
-			for _, m := range members {
+			for _, m := range snapshotMembers() {
 				if strings.Contains(strings.ToLower(m.Name), q) || strings.Contains(strings.ToLower(m.ID), q) {
 					out = append(out, m)
 				}
@@ -1492,10 +1922,52 @@ func showCheckInDialogShared(deviceID int, fixed bool) {
 
 	userIDRow := container.NewBorder(nil, nil, nil, noID, idEntry)
 
+	// The game list follows the device typed in.
+	gameSelect := widget.NewSelect(nil, nil)
+	gameSelect.PlaceHolder = noGame
+	setGames := func(id int) {
+		gameSelect.ClearSelected()
+		if games := deviceGames(id); id != 0 && len(games) > 0 {
+			gameSelect.Options = append([]string{noGame}, games...)
+			gameSelect.Enable()
+		} else {
+			gameSelect.Options = nil
+			gameSelect.Disable()
+		}
+		gameSelect.Refresh()
+	}
+	// On a running event's device the check-in is for the event unless
+	// staff untick it, which registerUser then refuses.
+	participant := widget.NewCheck("", nil)
+	eventID := ""
+	setEvent := func(id int) {
+		eventID = ""
+		participant.Hide()
+		if t := snapshotState().reservation(id, time.Now()); t != nil {
+			eventID = t.ID
+			participant.Text = "Participant in " + t.Name
+			participant.SetChecked(true)
+			participant.Show()
+		}
+	}
+	if fixed {
+		setGames(deviceID)
+		setEvent(deviceID)
+	} else {
+		setGames(0)
+		setEvent(0)
+		deviceEntry.OnChanged = func(text string) {
+			id, _ := strconv.Atoi(strings.TrimSpace(text))
+			setGames(id)
+			setEvent(id)
+		}
+	}
+
 	form := widget.NewForm(
 		widget.NewFormItem("Name:", nameEntry),
 		widget.NewFormItem("User ID:", userIDRow),
 		widget.NewFormItem("Device ID:", deviceEntry),
+		widget.NewFormItem("Game:", gameSelect),
 	)
 
 	onConfirm := func() {
@@ -1524,16 +1996,32 @@ func showCheckInDialogShared(deviceID int, fixed bool) {
 			}
 		}
 
-		if err := registerUser(name, uid, targetDeviceID); err != nil {
-			dialog.ShowError(err, mainWindow)
-			return
+		hide := func() {
+			if dlg != nil {
+				dlg.Hide()
+			}
 		}
-		if dlg != nil {
-			dlg.Hide()
+		game := gameSelect.Selected
+		if game == noGame {
+			game = ""
+		}
+		tournamentID := ""
+		if eventID != "" && participant.Checked {
+			tournamentID = eventID
 		}
+		register := func(afterHours bool) error {
+			return registerUserHours(name, uid, targetDeviceID, game, tournamentID, "", actingStaff(), afterHours)
+		}
+		if err := register(false); err != nil {
+			if !offerAfterHours(err, func() error { return register(true) }, hide) {
+				dialog.ShowError(err, mainWindow)
+			}
+			return
+		}
+		hide()
 	}
 
-	content := container.NewVBox(search, scroll, form)
+	content := container.NewVBox(search, scroll, form, participant)
 
 	dlg = dialog.NewCustomConfirm("Check In User", "Check In", "Cancel", content, func(ok bool) {
 		if ok {
@@ -1554,15 +2042,16 @@ func showCheckInDialog() {
 }
 
 func showCheckOutDialog() {
-	if len(activeUsers) == 0 {
+	users := snapshotState().Users
+	if len(users) == 0 {
 		dialog.ShowInformation("Check Out", "No active users to check out.", mainWindow)
 		return
 	}
 
-	display := make([]string, len(activeUsers))
-	ids := make([]string, len(activeUsers))
+	display := make([]string, len(users))
+	ids := make([]string, len(users))
 
-	for i, u := range activeUsers {
+	for i, u := range users {
 		displayName := u.Name
 		if len(displayName) > 25 {
 			displayName = displayName[:22] + "..."
@@ -1595,26 +2084,25 @@ func showCheckOutDialog() {
 			dialog.ShowError(fmt.Errorf("invalid user selection"), mainWindow)
 			return
 		}
-		if err := checkoutUser(target); err != nil {
-			dialog.ShowError(err, mainWindow)
-		}
+		checkoutWithEquipment(target)
 	}, mainWindow)
 
 	dlg.Resize(fyne.NewSize(450, dlg.MinSize().Height))
 	dlg.Show()
 }
 
-// Add this function after showCheckOutDialog (around line 1020)
-
+// showSwitchStationDialog moves a user to another device, or swaps them with
+// the user on it.
 func showSwitchStationDialog() {
-	if len(activeUsers) == 0 {
+	snap := snapshotState()
+	if len(snap.Users) == 0 {
 		dialog.ShowInformation("Switch Station", "No active users to switch.", mainWindow)
 		return
 	}
 
 	// Filter only users currently assigned to a device (not in queue)
 	assignedUsers := []User{}
-	for _, u := range activeUsers {
+	for _, u := range snap.Users {
 		if u.PCID != 0 {
 			assignedUsers = append(assignedUsers, u)
 		}
@@ -1634,7 +2122,7 @@ func showSwitchStationDialog() {
 			displayName = displayName[:22] + "..."
 		}
 		deviceType := "PC"
-		d := getDeviceByID(u.PCID)
+		d := snap.device(u.PCID)
 		if d != nil && d.Type == "Console" {
 			deviceType = "Console"
 		}
@@ -1647,10 +2135,12 @@ func showSwitchStationDialog() {
 
 	deviceEntry := widget.NewEntry()
 	deviceEntry.SetPlaceHolder("Enter New Device ID (1-18)")
+	swapCheck := widget.NewCheck("Swap with the user on that PC", nil)
 
 	form := widget.NewForm(
 		widget.NewFormItem("User:", userSelector),
 		widget.NewFormItem("New Device:", deviceEntry),
+		widget.NewFormItem("", swapCheck),
 	)
 
 	dlg := dialog.NewCustomConfirm("Switch Station", "Switch", "Cancel", form, func(ok bool) {
@@ -1689,7 +2179,23 @@ func showSwitchStationDialog() {
 			return
 		}
 
-		if err := switchUserStation(selectedUser.ID, newDeviceID); err != nil {
+		if d := snapshotState().device(newDeviceID); swapCheck.Checked && d != nil && d.Type == "PC" && d.UserID != "" {
+			other := snapshotState().user(d.UserID)
+			if err := swapUsers(selectedUser.ID, d.UserID, actingStaff()); err != nil {
+				dialog.ShowError(err, mainWindow)
+				return
+			}
+			otherName := d.UserID
+			if other != nil {
+				otherName = other.Name
+			}
+			dialog.ShowInformation("Success",
+				fmt.Sprintf("Swapped %s (now on device %d) and %s (now on device %d)", selectedUser.Name, newDeviceID, otherName, selectedUser.PCID),
+				mainWindow)
+			return
+		}
+
+		if err := switchUserStation(selectedUser.ID, newDeviceID, actingStaff()); err != nil {
 			dialog.ShowError(err, mainWindow)
 			return
 		}
@@ -1706,6 +2212,10 @@ func showSwitchStationDialog() {
 // ---------- Main ----------
 
 func main() {
+	if handled, code := runCLI(os.Args[1:]); handled {
+		os.Exit(code)
+	}
+
 	initData()
 	_ = os.MkdirAll(imgBaseDir, 0o755)
 
@@ -1717,17 +2227,35 @@ func main() {
 	deviceStatus := buildDeviceRoomContent()
 	logView := buildLogView()
 
-	// Update this section in main() (around line 1040)
 	checkInButton := widget.NewButtonWithIcon("Check In", theme.ContentAddIcon(), showCheckInDialog)
+	groupButton := widget.NewButtonWithIcon("Group", theme.AccountIcon(), showGroupCheckInDialog)
 	checkOutButton := widget.NewButtonWithIcon("Check Out", theme.ContentRemoveIcon(), showCheckOutDialog)
 	switchButton := widget.NewButtonWithIcon("Switch Station", theme.NavigateNextIcon(), showSwitchStationDialog)
-	toolbar := container.NewHBox(checkInButton, checkOutButton, switchButton, layout.NewSpacer())
+	boardButton := widget.NewButtonWithIcon("Status Board", theme.ViewFullScreenIcon(), showStatusBoard)
+	kioskButton := widget.NewButtonWithIcon("Kiosk", theme.AccountIcon(), enterKioskMode)
+	undoBtn, redoBtn := buildUndoButtons()
+	addUndoShortcuts(mainWindow.Canvas())
+	if err := loadStaff(); err != nil {
+		fmt.Println("Error loading staff:", err)
+	}
+	staffLabel = widget.NewLabel("")
+	updateStaffLabel()
+	staffButton := widget.NewButtonWithIcon("Staff", theme.SettingsIcon(), showStaffDialog)
+	auditButton := widget.NewButtonWithIcon("Audit", theme.HistoryIcon(), showAuditViewer)
+	shiftButton := widget.NewButtonWithIcon("Shift", theme.DocumentIcon(), showShiftDialog)
+	powerButton := widget.NewButtonWithIcon("Power", theme.ViewRefreshIcon(), showPowerDialog)
+	equipmentButton := widget.NewButtonWithIcon("Equipment", theme.ListIcon(), showEquipmentDialog)
+	eventsButton := widget.NewButtonWithIcon("Events", theme.StorageIcon(), showTournamentsDialog)
+	lockButton := widget.NewButtonWithIcon("Lock", theme.LogoutIcon(), lockScreen)
+	toolbar := container.NewHBox(checkInButton, groupButton, checkOutButton, switchButton, widget.NewSeparator(), undoBtn, redoBtn,
+		layout.NewSpacer(), eventsButton, equipmentButton, powerButton, boardButton, kioskButton, widget.NewSeparator(), staffLabel, staffButton, auditButton, shiftButton, lockButton)
 	totalDevicesLabel := widget.NewLabel("")
 	activeUsersLabel := widget.NewLabel("")
 
 	updateStatus := func() {
-		totalDevicesLabel.SetText(fmt.Sprintf("Total Devices: %d", len(allDevices)))
-		activeUsersLabel.SetText(fmt.Sprintf("Active Users: %d", len(activeUsers)))
+		snap := snapshotState()
+		totalDevicesLabel.SetText(fmt.Sprintf("Total Devices: %d", len(snap.Devices)))
+		activeUsersLabel.SetText(fmt.Sprintf("Active Users: %d", len(snap.Users)))
 	}
 	updateStatus()
 
@@ -1748,15 +2276,70 @@ func main() {
 		}
 	}
 
-	top := container.NewVBox(toolbar, widget.NewSeparator())
+	instanceBanner := widget.NewLabel("")
+	instanceBanner.Wrapping = fyne.TextWrapWord
+	instanceBanner.Importance = widget.WarningImportance
+	updateInstanceBanner := func() {
+		if msg := instanceWarning(); msg != "" {
+			instanceBanner.SetText(msg)
+			instanceBanner.Show()
+		} else {
+			instanceBanner.Hide()
+		}
+	}
+	acquireInstanceLock()
+	if instanceLock != nil {
+		startWebhookSender()
+		startAgents()
+		startGroupSeating()
+	}
+	updateInstanceBanner()
+
+	top := container.NewVBox(toolbar, instanceBanner, buildAlertBanner(), widget.NewSeparator())
 	bottom := container.NewVBox(widget.NewSeparator(), statusBar)
 	root := container.NewBorder(top, bottom, nil, nil, tabs)
 	mainWindow.SetContent(root)
+	if !startInKiosk {
+		lockScreen()
+	}
+
+	if appConfig.API.Enabled {
+		if _, err := startAPIServer(appConfig.API); err != nil {
+			fmt.Println("Error starting API server:", err)
+		}
+	}
+
+	// Each view redraws only for the events that affect it; bursts (such as
+	// the checkout+checkin of a station switch) arrive as one batch.
+	onUIEvents(func([]LoungeEvent) { deviceLayout.UpdateDevices() },
+		EventCheckIn, EventCheckOut, EventAssign, EventSwitch, EventReload, EventUndo, EventRedo, EventAgentStatus, EventTournament)
+	onUIEvents(func([]LoungeEvent) { refreshPendingIcons() },
+		EventQueueJoin, EventQueueLeave, EventAssign, EventReload, EventUndo, EventRedo)
+	onUIEvents(func([]LoungeEvent) { updateStatus() },
+		EventCheckIn, EventQueueJoin, EventCheckOut, EventQueueLeave, EventReload, EventUndo, EventRedo)
+	onUIEvents(func([]LoungeEvent) { refreshUndoButtons() })
+	onUIEvents(func([]LoungeEvent) { checkAlertRules(time.Now()) },
+		EventCheckIn, EventQueueJoin, EventCheckOut, EventQueueLeave, EventAssign, EventSwitch, EventReload, EventUndo, EventRedo)
+	onUIEvents(func([]LoungeEvent) {
+		if logTable != nil {
+			logTable.Refresh()
+		} else {
+			logRefreshPending = true
+		}
+	}, EventLogUpdated, EventAssign)
+	onUIEvents(func([]LoungeEvent) { refreshStatusBoard() },
+		EventCheckIn, EventQueueJoin, EventCheckOut, EventQueueLeave, EventAssign, EventSwitch, EventReload, EventUndo, EventRedo, EventTournament)
 
 	go func() {
 		logTicker := time.NewTicker(5 * time.Minute)
 		lastDate := time.Now().Format("2006-01-02")
 		defer logTicker.Stop()
+		syncTicker := time.NewTicker(dataSyncInterval)
+		defer syncTicker.Stop()
+		hoursTicker := time.NewTicker(time.Minute)
+		defer hoursTicker.Stop()
+		alertTicker := time.NewTicker(alertInterval)
+		defer alertTicker.Stop()
 
 		for {
 			select {
@@ -1773,19 +2356,42 @@ func main() {
 						}
 					}
 				})
-			case <-refreshTrigger:
+			case <-alertTicker.C:
+				fyne.Do(func() { checkAlertRules(time.Now()) })
+			case <-hoursTicker.C:
+				fyne.Do(func() {
+					checkOpeningHours(time.Now())
+					checkTournaments(time.Now())
+				})
+			case <-syncTicker.C:
+				var usersChanged, logChanged bool
+				withState(func() { usersChanged, logChanged = syncFromDisk() })
 				fyne.Do(func() {
-					updateStatus()
-					tabs.Items[0].Content = buildDeviceRoomContent()
-					tabs.Refresh()
-					if mainWindow != nil && mainWindow.Content() != nil {
-						mainWindow.Content().Refresh()
+					acquireInstanceLock()
+					if instanceLock != nil {
+						startWebhookSender()
+						startAgents()
+						startGroupSeating()
+					}
+					updateInstanceBanner()
+					if logChanged {
+						updateCurrentLogEntriesCache()
+						if logTable != nil {
+							logTable.Refresh()
+						}
 					}
 				})
+				if usersChanged {
+					publishEvent(LoungeEvent{Type: EventReload})
+				}
 			}
 		}
 	}()
 
+	if startInKiosk {
+		enterKioskMode()
+	}
+
 	mainWindow.SetMaster()
 	mainWindow.ShowAndRun()
 }
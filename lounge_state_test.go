@@ -0,0 +1,192 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+// setupTestLounge runs the test against empty data files in a temp folder.
+func setupTestLounge(t *testing.T) {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		stopAgents()
+		loungeBus.unsubscribeAll()
+		flushLogWrites()
+		_ = os.Chdir(wd)
+	})
+	headless = true
+	initData()
+}
+
+// freePCLocked returns a free PC, or 0; call holding the state lock.
+func freePCLocked() int {
+	for _, d := range allDevices {
+		if d.Type == "PC" && d.Status == "free" {
+			return d.ID
+		}
+	}
+	return 0
+}
+
+// checkStateLocked reports a PC shared by two users or a device whose status
+// disagrees with who is on it.
+func checkStateLocked() error {
+	on := map[int]string{}
+	for _, u := range activeUsers {
+		if u.PCID == 0 {
+			continue
+		}
+		d := getDeviceByID(u.PCID)
+		if d == nil {
+			return fmt.Errorf("%s is on missing device %d", u.ID, u.PCID)
+		}
+		if d.Type != "PC" {
+			continue
+		}
+		if other, ok := on[u.PCID]; ok {
+			return fmt.Errorf("PC %d has both %s and %s", u.PCID, other, u.ID)
+		}
+		on[u.PCID] = u.ID
+	}
+	for _, d := range allDevices {
+		if d.Type != "PC" {
+			continue
+		}
+		if id := on[d.ID]; (id == "") != (d.Status == "free") || d.UserID != id {
+			return fmt.Errorf("PC %d is %s for %q but has %q", d.ID, d.Status, d.UserID, id)
+		}
+	}
+	return nil
+}
+
+// TestConcurrentCheckInsAndCheckouts hammers the state from many goroutines,
+// as the window, API, kiosk and agents do. Run it with -race.
+func TestConcurrentCheckInsAndCheckouts(t *testing.T) {
+	setupTestLounge(t)
+
+	const workers, rounds = 24, 8
+	stop := make(chan struct{})
+	readerErr := make(chan error, 1)
+	var readers sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				snap := snapshotState()
+				_ = snap.usersOn(1)
+				var err error
+				withState(func() { err = checkStateLocked() })
+				if err != nil {
+					select {
+					case readerErr <- err:
+					default:
+					}
+					return
+				}
+				time.Sleep(time.Millisecond)
+			}
+		}()
+	}
+
+	var workersDone sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		workersDone.Add(1)
+		go func(w int) {
+			defer workersDone.Done()
+			for r := 0; r < rounds; r++ {
+				id := fmt.Sprintf("w%d-%d", w, r)
+				if r%2 == 0 {
+					// Straight onto a PC; losing the race for it is fine.
+					var pc int
+					withState(func() { pc = freePCLocked() })
+					if pc == 0 || registerUser("User "+id, id, pc, "", "test") != nil {
+						continue
+					}
+				} else {
+					// Through the queue, then onto whatever PC is free.
+					if err := registerUser("User "+id, id, 0, "", "test"); err != nil {
+						t.Errorf("queue %s: %v", id, err)
+						continue
+					}
+					var err error
+					withState(func() {
+						if pc := freePCLocked(); pc != 0 {
+							_, err = assignQueuedUserLocked(id, pc)
+						}
+					})
+					if err != nil {
+						t.Errorf("assign %s: %v", id, err)
+					}
+				}
+				if _, err := checkoutUser(id, "test"); err != nil {
+					t.Errorf("checkout %s: %v", id, err)
+				}
+			}
+		}(w)
+	}
+	workersDone.Wait()
+	close(stop)
+	readers.Wait()
+	select {
+	case err := <-readerErr:
+		t.Fatal(err)
+	default:
+	}
+
+	flushLogWrites()
+	snap := snapshotState()
+	if len(snap.Users) != 0 {
+		t.Errorf("%d users still checked in: %v", len(snap.Users), snap.Users)
+	}
+	for _, d := range snap.Devices {
+		if d.Status != "free" {
+			t.Errorf("device %d is %s after everyone left", d.ID, d.Status)
+		}
+	}
+	entries, err := readDailyLogEntries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if e.CheckOutTime.IsZero() {
+			t.Errorf("log entry for %s was never closed", e.UserID)
+		}
+	}
+}
+
+// TestQueueWantType checks that the wanted device type is kept while queued
+// and cleared once the user is assigned.
+func TestQueueWantType(t *testing.T) {
+	setupTestLounge(t)
+	if err := queueUser("Ann", "a1", "Spaceship", "test"); err == nil {
+		t.Fatal("queued for a device type the lounge does not have")
+	}
+	if err := queueUser("Ann", "a1", "pc", "test"); err != nil {
+		t.Fatal(err)
+	}
+	if u := snapshotState().user("a1"); u == nil || u.WantType != "PC" {
+		t.Fatalf("queued user is %+v, want WantType PC", u)
+	}
+	if err := assignQueuedUserToDevice("a1", 3, "test"); err != nil {
+		t.Fatal(err)
+	}
+	if u := snapshotState().user("a1"); u == nil || u.WantType != "" {
+		t.Fatalf("assigned user is %+v, want no WantType", u)
+	}
+}
@@ -0,0 +1,317 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"image/color"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+)
+
+// ---------- Power ----------
+//
+// PCs with a MAC address under "devices" in log/config.json can be woken with
+// a Wake-on-LAN magic packet; PCs with an agent can be shut down through it.
+// A PC counts as on while its agent is connected.
+
+const (
+	wolDefaultAddr = "255.255.255.255:9"
+	wakeTimeout    = 5 * time.Minute
+	stopTimeout    = 3 * time.Minute
+	// closingShutdownWindow is how long after closing the free PCs are
+	// still shut down, so a restart next morning does not power them off.
+	closingShutdownWindow = 30 * time.Minute
+)
+
+const (
+	auditWake     = "wake"
+	auditShutdown = "shutdown"
+)
+
+// Power states shown on the floor plan.
+const (
+	powerOn       = "on"
+	powerOff      = "off"
+	powerWaking   = "waking"
+	powerStopping = "shutting down"
+)
+
+// DeviceConfig holds per-device settings keyed by device ID.
+type DeviceConfig struct {
+	MAC string `json:"mac,omitempty"`
+	// Broadcast is where the magic packet goes; 255.255.255.255:9 by default.
+	Broadcast string `json:"broadcast,omitempty"`
+	// Games are the games installed on the device, offered at check-in.
+	Games []string `json:"games,omitempty"`
+}
+
+func deviceConfig(id int) DeviceConfig { return appConfig.Devices[strconv.Itoa(id)] }
+
+// wakeableDevices lists the devices that have a MAC address, in ID order.
+func wakeableDevices() []int {
+	var ids []int
+	for key, dc := range appConfig.Devices {
+		if id, err := strconv.Atoi(key); err == nil && dc.MAC != "" {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// magicPacket is six 0xFF bytes followed by the MAC sixteen times.
+func magicPacket(mac net.HardwareAddr) []byte {
+	p := make([]byte, 0, 6+16*len(mac))
+	for i := 0; i < 6; i++ {
+		p = append(p, 0xFF)
+	}
+	for i := 0; i < 16; i++ {
+		p = append(p, mac...)
+	}
+	return p
+}
+
+func wakeDevice(id int) error {
+	dc := deviceConfig(id)
+	if dc.MAC == "" {
+		return fmt.Errorf("device %d has no MAC address", id)
+	}
+	mac, err := net.ParseMAC(dc.MAC)
+	if err != nil {
+		return fmt.Errorf("device %d: %w", id, err)
+	}
+	addr := dc.Broadcast
+	if addr == "" {
+		addr = wolDefaultAddr
+	}
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return fmt.Errorf("device %d: %w", id, err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write(magicPacket(mac)); err != nil {
+		return fmt.Errorf("device %d: %w", id, err)
+	}
+	setPowerPending(id, powerWaking, wakeTimeout)
+	return nil
+}
+
+// wakeDevices wakes each device and returns the errors joined.
+func wakeDevices(ids []int, by string) error {
+	var errs []error
+	for _, id := range ids {
+		err := wakeDevice(id)
+		recordAudit(by, auditWake, fmt.Sprintf("device %d", id), nil, nil, err)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// shutdownDevices powers off the given devices through their agents,
+// skipping any that someone is checked in on.
+func shutdownDevices(ids []int, by string) error {
+	snap := snapshotState()
+	var errs []error
+	for _, id := range ids {
+		var err error
+		if d := snap.device(id); d != nil && d.Status != "free" {
+			err = fmt.Errorf("device %d is in use", id)
+		} else if err = shutdownAgent(id); err == nil {
+			setPowerPending(id, powerStopping, stopTimeout)
+		}
+		recordAudit(by, auditShutdown, fmt.Sprintf("device %d", id), nil, nil, err)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ---------- Power state ----------
+
+type powerPending struct {
+	state string
+	until time.Time
+}
+
+var powerPendings = map[int]powerPending{} // guarded by agentMu
+
+// setPowerPending records a wake or shutdown in progress; an empty state
+// clears it.
+func setPowerPending(id int, state string, d time.Duration) {
+	agentMu.Lock()
+	if state == "" {
+		delete(powerPendings, id)
+	} else {
+		powerPendings[id] = powerPending{state: state, until: time.Now().Add(d)}
+	}
+	agentMu.Unlock()
+	notifyLocal(LoungeEvent{Type: EventAgentStatus, DeviceID: id})
+	if state != "" {
+		// Redraw when the wait runs out even if the agent never answers.
+		time.AfterFunc(d, func() { notifyLocal(LoungeEvent{Type: EventAgentStatus, DeviceID: id}) })
+	}
+}
+
+// powerState is a device's power as far as the lounge knows; ok is false for
+// devices with no agent, whose state cannot be seen.
+func powerState(id int) (state string, ok bool) {
+	agentMu.Lock()
+	defer agentMu.Unlock()
+	if _, has := agentLinks[id]; !has {
+		return "", false
+	}
+	connected := agentStatus[id].Connected
+	if p, has := powerPendings[id]; has && time.Now().Before(p.until) {
+		switch {
+		case p.state == powerWaking && !connected, p.state == powerStopping && connected:
+			return p.state, true
+		}
+	}
+	if connected {
+		return powerOn, true
+	}
+	return powerOff, true
+}
+
+// powerDotColor extends agentDotColor with waking and shutting down.
+func powerDotColor(d Device) (color.Color, bool) {
+	state, ok := powerState(d.ID)
+	if !ok {
+		return nil, false
+	}
+	switch state {
+	case powerWaking:
+		return color.NRGBA{R: 0x1e, G: 0x66, B: 0xf5, A: 0xff}, true
+	case powerStopping:
+		return color.NRGBA{R: 0x88, G: 0x39, B: 0xef, A: 0xff}, true
+	}
+	return agentDotColor(d)
+}
+
+// ---------- Closing-time shutdown ----------
+
+var shutdownDoneFor time.Time // Fyne thread only
+
+// shutdownDue reports, once per closing time, whether the free PCs should
+// now be shut down. Fyne thread only.
+func shutdownDue(closedAt, now time.Time) bool {
+	if !appConfig.Hours.ShutdownAtClose || closedAt.Equal(shutdownDoneFor) || now.Sub(closedAt) > closingShutdownWindow {
+		return false
+	}
+	shutdownDoneFor = closedAt
+	return true
+}
+
+// shutdownFreePCs powers off every free PC whose agent is connected.
+func shutdownFreePCs(by string) error {
+	var ids []int
+	for _, d := range snapshotState().Devices {
+		if st, ok := powerState(d.ID); ok && st == powerOn && d.Status == "free" {
+			ids = append(ids, d.ID)
+		}
+	}
+	return shutdownDevices(ids, by)
+}
+
+// ---------- Power dialog ----------
+
+func showPowerDialog() {
+	if !requirePermission(permPower, "power PCs on or off") {
+		return
+	}
+	snap := snapshotState()
+	var ids []int
+	for _, d := range snap.Devices {
+		_, agent := powerState(d.ID)
+		if agent || deviceConfig(d.ID).MAC != "" {
+			ids = append(ids, d.ID)
+		}
+	}
+	if len(ids) == 0 {
+		dialog.ShowInformation("Power", "No device has a MAC address or an agent configured.", mainWindow)
+		return
+	}
+
+	checks := map[int]*widget.Check{}
+	rows := container.NewVBox()
+	for _, id := range ids {
+		state, ok := powerState(id)
+		if !ok {
+			state = "unknown"
+		}
+		var notes []string
+		if deviceConfig(id).MAC == "" {
+			notes = append(notes, "no MAC")
+		}
+		if d := snap.device(id); d != nil && d.Status != "free" {
+			notes = append(notes, "in use")
+		}
+		text := fmt.Sprintf("%s %d: %s", deviceTypeName(snap, id), id, state)
+		if len(notes) > 0 {
+			text += " (" + strings.Join(notes, ", ") + ")"
+		}
+		checks[id] = widget.NewCheck(text, nil)
+		rows.Add(checks[id])
+	}
+	selected := func() []int {
+		var out []int
+		for _, id := range ids {
+			if checks[id].Checked {
+				out = append(out, id)
+			}
+		}
+		return out
+	}
+	report := func(err error) {
+		if err != nil {
+			dialog.ShowError(err, mainWindow)
+		}
+	}
+
+	var dlg dialog.Dialog
+	wakeAll := widget.NewButtonWithIcon("Wake All", theme.MediaPlayIcon(), func() {
+		dlg.Hide()
+		report(wakeDevices(wakeableDevices(), actingStaff()))
+	})
+	wakeSel := widget.NewButton("Wake Selected", func() {
+		dlg.Hide()
+		report(wakeDevices(selected(), actingStaff()))
+	})
+	stopSel := widget.NewButtonWithIcon("Shut Down Selected", theme.MediaStopIcon(), func() {
+		sel := selected()
+		if len(sel) == 0 {
+			return
+		}
+		dialog.ShowConfirm("Shut Down", fmt.Sprintf("Shut down %d PC(s)? PCs in use are skipped.", len(sel)), func(ok bool) {
+			if ok {
+				dlg.Hide()
+				report(shutdownDevices(sel, actingStaff()))
+			}
+		}, mainWindow)
+	})
+	stopSel.Importance = widget.DangerImportance
+
+	content := container.NewBorder(nil, container.NewHBox(wakeAll, wakeSel, stopSel), nil, nil, container.NewVScroll(rows))
+	dlg = dialog.NewCustom("Power", "Close", content, mainWindow)
+	dlg.Resize(fyne.NewSize(460, 520))
+	dlg.Show()
+}
+
+func deviceTypeName(snap stateSnapshot, id int) string {
+	if d := snap.device(id); d != nil {
+		return d.Type
+	}
+	return "Device"
+}
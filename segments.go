@@ -0,0 +1,284 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ---------- Session segments ----------
+//
+// Moving a user to another device keeps their session: the log entry keeps
+// its check-in time and records each device in Segments. PCID, Game and
+// Tournament on the entry are always those of the last segment. Entries of
+// sessions that never moved have no segments.
+
+// Segment is the part of a session spent on one device.
+type Segment struct {
+	PCID       int       `json:"pc_id"`
+	Start      time.Time `json:"start"`
+	End        time.Time `json:"end,omitempty"`
+	Game       string    `json:"game,omitempty"`
+	Tournament string    `json:"tournament,omitempty"`
+	// By moved the user onto the device; empty for the first segment.
+	By string `json:"by,omitempty"`
+}
+
+// segments lists the devices the session used. A session that never moved
+// is one segment spanning the whole entry.
+func (e LogEntry) segments() []Segment {
+	if len(e.Segments) > 0 {
+		return e.Segments
+	}
+	return []Segment{{PCID: e.PCID, Start: e.CheckInTime, End: e.CheckOutTime, Game: e.Game, Tournament: e.Tournament}}
+}
+
+// hours is how long the segment ran; zero while it is open.
+func (s Segment) hours() float64 {
+	if s.End.IsZero() {
+		return 0
+	}
+	return s.End.Sub(s.Start).Hours()
+}
+
+// deviceRoute is "3" or, for a session that moved, "3 → 7".
+func (e LogEntry) deviceRoute() string {
+	var ids []string
+	for _, s := range e.segments() {
+		ids = append(ids, strconv.Itoa(s.PCID))
+	}
+	return strings.Join(ids, " → ")
+}
+
+// applyLogMove ends the open session's current segment at and starts one on
+// u's device; u is the user after the move.
+func applyLogMove(entries []LogEntry, u User, at time.Time, by string) ([]LogEntry, error) {
+	i := findSessionEntry(entries, u)
+	if i < 0 || !entries[i].CheckOutTime.IsZero() {
+		return entries, fmt.Errorf("no open log entry for user %s (ID: %s) checked in at %s", u.Name, u.ID, u.CheckInTime.Format("15:04:05"))
+	}
+	e := &entries[i]
+	if len(e.Segments) == 0 {
+		e.Segments = []Segment{{PCID: e.PCID, Start: e.CheckInTime, Game: e.Game, Tournament: e.Tournament}}
+	}
+	e.Segments[len(e.Segments)-1].End = at
+	e.Segments = append(e.Segments, Segment{PCID: u.PCID, Start: at, Game: u.Game, Tournament: u.Tournament, By: by})
+	e.PCID, e.Game, e.Tournament = u.PCID, u.Game, u.Tournament
+	return entries, nil
+}
+
+// revertLogMove drops the last segment and reopens the one before it, back
+// on u's device; u is the user before the move.
+func revertLogMove(entries []LogEntry, u User) {
+	i := findSessionEntry(entries, u)
+	if i < 0 {
+		fmt.Printf("No log entry for user %s (ID: %s) checked in at %s.\n", u.Name, u.ID, u.CheckInTime.Format("15:04:05"))
+		return
+	}
+	e := &entries[i]
+	if n := len(e.Segments); n > 1 {
+		e.Segments = e.Segments[:n-1]
+		e.Segments[n-2].End = time.Time{}
+	}
+	if len(e.Segments) == 1 {
+		e.Segments = nil
+	}
+	e.PCID, e.Game, e.Tournament = u.PCID, u.Game, u.Tournament
+}
+
+// closeLastSegment ends a moved session's last segment with the entry.
+func closeLastSegment(e *LogEntry) {
+	if n := len(e.Segments); n > 0 {
+		e.Segments[n-1].End = e.CheckOutTime
+	}
+}
+
+// logMoveAsync records a move in the session's log entry off the UI thread.
+// It is queued behind the check-in that wrote the entry; a failure is shown
+// to staff (see reportLogError).
+func logMoveAsync(u User, at time.Time, by string) {
+	queueLogWrite(func() error {
+		err := tryEditSessionLog(u, func(entries []LogEntry) ([]LogEntry, error) {
+			return applyLogMove(entries, u, at, by)
+		})
+		if err != nil {
+			return fmt.Errorf("move of %s to device %d: %w", u.Name, u.PCID, err)
+		}
+		return nil
+	})
+}
+
+// logSwapAsync records both halves of a swap in one queued write. Sessions
+// in the same day's log are changed in a single rewrite that leaves the file
+// alone if either half fails; a swap across two days' logs edits them in
+// turn and stops at the first failure.
+func logSwapAsync(a, b User, at time.Time, by string) {
+	queueLogWrite(func() error {
+		edits := [][]User{{a, b}}
+		if logFilePathForDate(a.CheckInTime) != logFilePathForDate(b.CheckInTime) {
+			edits = [][]User{{a}, {b}}
+		}
+		for _, users := range edits {
+			err := tryEditSessionLog(users[0], func(entries []LogEntry) ([]LogEntry, error) {
+				for _, u := range users {
+					var err error
+					if entries, err = applyLogMove(entries, u, at, by); err != nil {
+						return nil, err
+					}
+				}
+				return entries, nil
+			})
+			if err != nil {
+				return fmt.Errorf("swap of %s and %s: %w", a.Name, b.Name, err)
+			}
+		}
+		return nil
+	})
+}
+
+// moveUserLocked moves a checked-in user to another device without ending
+// their session, and returns the undo step. Every check runs before anything
+// changes, so a refused move leaves the state as it was.
+func moveUserLocked(userID string, newDeviceID int, by string, now time.Time) (undoStep, error) {
+	u := getUserByID(userID)
+	if u == nil {
+		return undoStep{}, fmt.Errorf("user ID %s not found", userID)
+	}
+	if u.PCID == 0 {
+		return undoStep{}, fmt.Errorf("user %s is in queue, use assign instead", userID)
+	}
+	oldDeviceID := u.PCID
+	if oldDeviceID == newDeviceID {
+		return undoStep{}, fmt.Errorf("user is already on device %d", newDeviceID)
+	}
+	newDevice := getDeviceByID(newDeviceID)
+	if newDevice == nil {
+		return undoStep{}, fmt.Errorf("target device ID %d does not exist", newDeviceID)
+	}
+	if newDevice.Type == "PC" && newDevice.Status != "free" {
+		return undoStep{}, fmt.Errorf("device %d is busy (occupied by UserID: %s)", newDeviceID, newDevice.UserID)
+	}
+	game, tournamentID := carriedOver(*u, newDeviceID, now)
+	if err := checkReservationLocked(newDeviceID, tournamentID, now); err != nil {
+		return undoStep{}, err
+	}
+
+	before := *u
+	u.PCID, u.Game, u.Tournament = newDeviceID, game, tournamentID
+	after := *u
+	newDevice.Status = "occupied"
+	if newDevice.Type == "PC" {
+		newDevice.UserID = userID
+	}
+	freed := releaseDevice(oldDeviceID)
+	saveData()
+	logMoveAsync(after, now, by)
+
+	publishEvent(LoungeEvent{Type: EventSwitch, UserID: userID, UserName: after.Name, DeviceID: newDeviceID, FromDeviceID: oldDeviceID})
+	if freed {
+		publishEvent(LoungeEvent{Type: EventDeviceFreed, DeviceID: oldDeviceID})
+	}
+	return undoStep{Kind: undoStepMove, Before: before, After: after, ClosedAt: now}, nil
+}
+
+// carriedOver is the game and event a user keeps on moving to deviceID: the
+// game only if it is installed there, the event only while it runs and
+// holds the device.
+func carriedOver(u User, deviceID int, now time.Time) (game, tournamentID string) {
+	game = u.Game
+	if checkGame(deviceID, game) != nil {
+		game = ""
+	}
+	tournamentID = u.Tournament
+	if t := tournamentByID(tournamentID); t == nil || !t.activeAt(now) || !t.hasDevice(deviceID) {
+		tournamentID = ""
+	}
+	return game, tournamentID
+}
+
+// releaseDevice updates a device someone just left and reports whether it
+// is now free. Call after activeUsers no longer has them on it.
+func releaseDevice(id int) bool {
+	dev := getDeviceByID(id)
+	if dev == nil {
+		return false
+	}
+	if dev.Type == "PC" || len(activeUserIDsOnDevice(id)) == 0 {
+		dev.Status = "free"
+		dev.UserID = ""
+		return true
+	}
+	dev.Status = "occupied"
+	return false
+}
+
+// ---------- Swap ----------
+
+// swapUsers exchanges the devices of two checked-in users. Both sessions
+// carry on, and both log entries get a new segment from the same moment.
+func swapUsers(aID, bID, by string) (err error) {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	beforeA, beforeB := userCopy(aID), userCopy(bID)
+	defer func() {
+		auditUserChange(by, EventSwitch, aID, beforeA, &err)
+		auditUserChange(by, EventSwitch, bID, beforeB, &err)
+	}()
+	steps, err := swapUsersLocked(aID, bID, by, time.Now())
+	if err != nil {
+		return err
+	}
+	a, b := steps[0].Before, steps[1].Before
+	recordUndo(undoOp{
+		Label: fmt.Sprintf("swap of %s on %s and %s on %s", a.Name, deviceName(a.PCID), b.Name, deviceName(b.PCID)),
+		By:    by,
+		Steps: steps,
+	})
+	return nil
+}
+
+// swapUsersLocked checks and performs a swap, returning one move step per
+// user.
+func swapUsersLocked(aID, bID, by string, now time.Time) ([]undoStep, error) {
+	if aID == bID {
+		return nil, fmt.Errorf("cannot swap user %s with themselves", aID)
+	}
+	a, b := getUserByID(aID), getUserByID(bID)
+	for i, u := range []*User{a, b} {
+		if u == nil {
+			return nil, fmt.Errorf("user ID %s not found", []string{aID, bID}[i])
+		}
+		if u.PCID == 0 {
+			return nil, fmt.Errorf("user %s is in queue, use assign instead", u.ID)
+		}
+	}
+	if a.PCID == b.PCID {
+		return nil, fmt.Errorf("%s and %s are both on device %d", a.Name, b.Name, a.PCID)
+	}
+	gameA, eventA := carriedOver(*a, b.PCID, now)
+	gameB, eventB := carriedOver(*b, a.PCID, now)
+	if err := checkReservationLocked(b.PCID, eventA, now); err != nil {
+		return nil, fmt.Errorf("%s: %w", a.Name, err)
+	}
+	if err := checkReservationLocked(a.PCID, eventB, now); err != nil {
+		return nil, fmt.Errorf("%s: %w", b.Name, err)
+	}
+
+	beforeA, beforeB := *a, *b
+	a.PCID, a.Game, a.Tournament = beforeB.PCID, gameA, eventA
+	b.PCID, b.Game, b.Tournament = beforeA.PCID, gameB, eventB
+	for _, u := range []*User{a, b} {
+		if d := getDeviceByID(u.PCID); d != nil && d.Type == "PC" {
+			d.UserID = u.ID
+		}
+	}
+	saveData()
+	logSwapAsync(*a, *b, now, by)
+	publishEvent(LoungeEvent{Type: EventSwitch, UserID: a.ID, UserName: a.Name, DeviceID: a.PCID, FromDeviceID: beforeA.PCID})
+	publishEvent(LoungeEvent{Type: EventSwitch, UserID: b.ID, UserName: b.Name, DeviceID: b.PCID, FromDeviceID: beforeB.PCID})
+	return []undoStep{
+		{Kind: undoStepMove, Before: beforeA, After: *a, ClosedAt: now},
+		{Kind: undoStepMove, Before: beforeB, After: *b, ClosedAt: now},
+	}, nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import "testing"
+
+// TestMoveRightAfterCheckIn moves a user before their check-in can have
+// reached the log; the move must still land in their entry.
+func TestMoveRightAfterCheckIn(t *testing.T) {
+	setupTestLounge(t)
+	for i := 0; i < 10; i++ {
+		id := string(rune('a' + i))
+		if err := registerUser("User "+id, id, 1+i, "", "test"); err != nil {
+			t.Fatal(err)
+		}
+		if err := switchUserStation(id, 11+i%6, "test"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := checkoutUser(id, "test"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	flushLogWrites()
+	entries, err := readDailyLogEntries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 10 {
+		t.Fatalf("got %d log entries, want 10", len(entries))
+	}
+	for _, e := range entries {
+		if len(e.Segments) != 2 || e.CheckOutTime.IsZero() || e.Segments[1].End.IsZero() {
+			t.Errorf("entry for %s is %+v, want two closed segments", e.UserID, e)
+		}
+	}
+}
+
+// TestSwapRightAfterCheckIns swaps two users whose check-ins may still be
+// queued; both entries must gain the new segment from the same moment.
+func TestSwapRightAfterCheckIns(t *testing.T) {
+	setupTestLounge(t)
+	if err := registerUser("Ann", "a1", 1, "", "test"); err != nil {
+		t.Fatal(err)
+	}
+	if err := registerUser("Bob", "b1", 2, "", "test"); err != nil {
+		t.Fatal(err)
+	}
+	if err := swapUsers("a1", "b1", "test"); err != nil {
+		t.Fatal(err)
+	}
+	flushLogWrites()
+	entries, err := readDailyLogEntries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("got %d log entries, want 2", len(entries))
+	}
+	want := map[string]int{"a1": 2, "b1": 1}
+	for _, e := range entries {
+		if len(e.Segments) != 2 || e.PCID != want[e.UserID] || !e.Segments[1].Start.Equal(entries[0].Segments[1].Start) {
+			t.Errorf("entry for %s is %+v", e.UserID, e)
+		}
+	}
+}
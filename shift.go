@@ -0,0 +1,344 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+)
+
+// ---------- Shift handover ----------
+//
+// Closing a shift saves a report to log/shifts/ covering everything since the
+// previous report (or since midnight for the first one) so the next attendant
+// can see what they are taking over.
+
+const shiftDir = "log/shifts"
+
+const auditShiftClose = "shift_close"
+
+type ShiftSession struct {
+	UserName string        `json:"user_name"`
+	UserID   string        `json:"user_id"`
+	DeviceID int           `json:"device_id"`
+	Time     time.Time     `json:"time"`
+	Duration time.Duration `json:"duration,omitempty"`
+}
+
+type ShiftIncident struct {
+	Time   time.Time `json:"time"`
+	Actor  string    `json:"actor"`
+	Action string    `json:"action"`
+	Detail string    `json:"detail"`
+}
+
+type ShiftReport struct {
+	Start    time.Time       `json:"start"`
+	End      time.Time       `json:"end"`
+	ClosedBy string          `json:"closed_by"`
+	Started  []ShiftSession  `json:"sessions_started"`
+	Ended    []ShiftSession  `json:"sessions_ended"`
+	Active   []ShiftSession  `json:"active"`
+	Queue    []ShiftSession  `json:"queue"`
+	Problems []ShiftIncident `json:"problems"`
+	// Incidents and Notes are written by the outgoing attendant.
+	Incidents string `json:"incidents,omitempty"`
+	Notes     string `json:"notes,omitempty"`
+	// Takings is cash counted at handover; the lounge has no billing.
+	Takings float64 `json:"takings,omitempty"`
+}
+
+func startOfDay(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
+
+// shiftReportFiles lists saved reports, oldest first.
+func shiftReportFiles() ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(shiftDir, "shift-*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+func readShiftReport(p string) (ShiftReport, error) {
+	var r ShiftReport
+	b, err := os.ReadFile(p)
+	if err != nil {
+		return r, err
+	}
+	if err := json.Unmarshal(b, &r); err != nil {
+		return r, fmt.Errorf("unmarshal %s: %w", p, err)
+	}
+	return r, nil
+}
+
+// shiftStart is when the shift being closed began.
+func shiftStart(now time.Time) time.Time {
+	files, err := shiftReportFiles()
+	if err == nil && len(files) > 0 {
+		if last, err := readShiftReport(files[len(files)-1]); err == nil && last.End.Before(now) {
+			return last.End
+		}
+	}
+	return startOfDay(now)
+}
+
+// isShiftProblem picks the audit records worth handing over: failed
+// operations, refused permissions and bad PINs.
+func isShiftProblem(r AuditRecord) bool {
+	return !r.OK || r.Action == auditDenied
+}
+
+func buildShiftReport(start, end time.Time) (ShiftReport, error) {
+	rep := ShiftReport{
+		Start: start, End: end,
+		Started: []ShiftSession{}, Ended: []ShiftSession{}, Active: []ShiftSession{},
+		Queue: []ShiftSession{}, Problems: []ShiftIncident{},
+	}
+	in := func(t time.Time) bool { return !t.Before(start) && t.Before(end) }
+
+	// Sessions are logged under the day they began, so a session that ended
+	// in this shift may sit in the previous day's file or, if still open,
+	// further back.
+	st := snapshotState()
+	from := startOfDay(start).AddDate(0, 0, -1)
+	for _, u := range st.Users {
+		if !u.CheckInTime.IsZero() && u.CheckInTime.Before(from) {
+			from = startOfDay(u.CheckInTime)
+		}
+	}
+	entries, err := readLogEntriesBetween(from, end)
+	if err != nil {
+		return rep, err
+	}
+	for _, e := range entries {
+		if in(e.CheckInTime) {
+			rep.Started = append(rep.Started, ShiftSession{UserName: e.UserName, UserID: e.UserID, DeviceID: e.PCID, Time: e.CheckInTime})
+		}
+		if !e.CheckOutTime.IsZero() && in(e.CheckOutTime) {
+			rep.Ended = append(rep.Ended, ShiftSession{UserName: e.UserName, UserID: e.UserID, DeviceID: e.PCID,
+				Time: e.CheckOutTime, Duration: e.CheckOutTime.Sub(e.CheckInTime)})
+		}
+	}
+
+	for _, u := range st.Users {
+		s := ShiftSession{UserName: u.Name, UserID: u.ID, DeviceID: u.PCID, Time: u.CheckInTime, Duration: end.Sub(u.CheckInTime)}
+		if u.PCID == 0 {
+			rep.Queue = append(rep.Queue, s)
+		} else {
+			rep.Active = append(rep.Active, s)
+		}
+	}
+	sort.Slice(rep.Active, func(i, j int) bool { return rep.Active[i].Duration > rep.Active[j].Duration })
+
+	recs, err := readAuditRecords()
+	if err != nil {
+		return rep, err
+	}
+	for _, r := range recs {
+		if in(r.Time) && isShiftProblem(r) {
+			detail := r.Target
+			if r.Error != "" {
+				detail = strings.TrimSpace(detail + ": " + r.Error)
+			}
+			rep.Problems = append(rep.Problems, ShiftIncident{Time: r.Time, Actor: r.Actor, Action: r.Action, Detail: detail})
+		}
+	}
+	return rep, nil
+}
+
+func saveShiftReport(rep ShiftReport) (string, error) {
+	if err := os.MkdirAll(shiftDir, 0o755); err != nil {
+		return "", err
+	}
+	data, err := json.MarshalIndent(rep, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("marshal shift report: %w", err)
+	}
+	p := filepath.Join(shiftDir, fmt.Sprintf("shift-%s.json", rep.End.Format("2006-01-02T150405")))
+	err = withDataLock(func() error { return os.WriteFile(p, data, 0o644) })
+	return p, err
+}
+
+// formatShiftReport renders a report as plain text for the viewer.
+func formatShiftReport(r ShiftReport) string {
+	var b strings.Builder
+	clock := func(t time.Time) string { return t.Format("Jan 02 15:04") }
+	fmt.Fprintf(&b, "Shift %s - %s, closed by %s\n", clock(r.Start), clock(r.End), orDash(r.ClosedBy))
+	if r.Takings != 0 {
+		fmt.Fprintf(&b, "Takings: %.2f\n", r.Takings)
+	}
+
+	section := func(title string, rows []ShiftSession, line func(ShiftSession) string) {
+		fmt.Fprintf(&b, "\n%s (%d)\n", title, len(rows))
+		for _, s := range rows {
+			b.WriteString("  " + line(s) + "\n")
+		}
+	}
+	section("Sessions started", r.Started, func(s ShiftSession) string {
+		return fmt.Sprintf("%s  %s (%s) on %s", s.Time.Format("15:04"), s.UserName, s.UserID, shiftDevice(s.DeviceID))
+	})
+	section("Sessions ended", r.Ended, func(s ShiftSession) string {
+		return fmt.Sprintf("%s  %s (%s) from %s after %s", s.Time.Format("15:04"), s.UserName, s.UserID, shiftDevice(s.DeviceID), formatDuration(s.Duration))
+	})
+	section("Still on a device", r.Active, func(s ShiftSession) string {
+		return fmt.Sprintf("%s (%s) on %s for %s", s.UserName, s.UserID, shiftDevice(s.DeviceID), formatDuration(s.Duration))
+	})
+	section("Queue", r.Queue, func(s ShiftSession) string {
+		return fmt.Sprintf("%s (%s) waiting %s", s.UserName, s.UserID, formatDuration(s.Duration))
+	})
+
+	fmt.Fprintf(&b, "\nProblems logged (%d)\n", len(r.Problems))
+	for _, p := range r.Problems {
+		fmt.Fprintf(&b, "  %s  %s %s: %s\n", p.Time.Format("15:04"), orDash(p.Actor), p.Action, p.Detail)
+	}
+	if r.Incidents != "" {
+		b.WriteString("\nIncidents\n" + indentLines(r.Incidents))
+	}
+	if r.Notes != "" {
+		b.WriteString("\nNotes\n" + indentLines(r.Notes))
+	}
+	return b.String()
+}
+
+func shiftDevice(id int) string {
+	if id == 0 {
+		return "the queue"
+	}
+	return fmt.Sprintf("device %d", id)
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func indentLines(s string) string {
+	var b strings.Builder
+	for _, l := range strings.Split(strings.TrimSpace(s), "\n") {
+		b.WriteString("  " + l + "\n")
+	}
+	return b.String()
+}
+
+// ---------- Shift dialog ----------
+
+// showShiftDialog lists saved handover reports, newest first, and offers to
+// close the current shift.
+func showShiftDialog() {
+	files, err := shiftReportFiles()
+	if err != nil {
+		dialog.ShowError(err, mainWindow)
+		return
+	}
+	for i, j := 0, len(files)-1; i < j; i, j = i+1, j-1 {
+		files[i], files[j] = files[j], files[i]
+	}
+
+	text := widget.NewLabel("No shift reports yet.")
+	text.TextStyle.Monospace = true
+	text.Wrapping = fyne.TextWrapWord
+	show := func(p string) {
+		r, err := readShiftReport(p)
+		if err != nil {
+			text.SetText(err.Error())
+			return
+		}
+		text.SetText(formatShiftReport(r))
+	}
+	list := widget.NewList(
+		func() int { return len(files) },
+		func() fyne.CanvasObject { return widget.NewLabel("") },
+		func(i widget.ListItemID, o fyne.CanvasObject) {
+			name := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(files[i]), "shift-"), ".json")
+			if t, err := time.ParseInLocation("2006-01-02T150405", name, time.Local); err == nil {
+				name = t.Format("Mon Jan 02 15:04")
+			}
+			o.(*widget.Label).SetText(name)
+		},
+	)
+	list.OnSelected = func(i widget.ListItemID) { show(files[i]) }
+	if len(files) > 0 {
+		list.Select(0)
+	}
+
+	var dlg dialog.Dialog
+	closeShift := widget.NewButtonWithIcon("Close Shift...", theme.DocumentSaveIcon(), func() {
+		dlg.Hide()
+		showCloseShiftDialog()
+	})
+	closeShift.Importance = widget.HighImportance
+
+	split := container.NewHSplit(list, container.NewScroll(text))
+	split.Offset = 0.25
+	content := container.NewBorder(nil, container.NewHBox(closeShift), nil, nil, split)
+	dlg = dialog.NewCustom("Shift Reports", "Close", content, mainWindow)
+	dlg.Resize(fyne.NewSize(860, 560))
+	dlg.Show()
+}
+
+func showCloseShiftDialog() {
+	end := time.Now()
+	start := shiftStart(end)
+
+	incidents := widget.NewMultiLineEntry()
+	incidents.SetPlaceHolder("Anything the next shift should know about: damage, complaints, bans...")
+	notes := widget.NewMultiLineEntry()
+	notes.SetPlaceHolder("Other handover notes")
+	takings := widget.NewEntry()
+	takings.SetPlaceHolder("0.00")
+
+	items := []*widget.FormItem{
+		widget.NewFormItem("Shift", widget.NewLabel(fmt.Sprintf("%s - %s", start.Format("Jan 02 15:04"), end.Format("15:04")))),
+		widget.NewFormItem("Incidents", incidents),
+		widget.NewFormItem("Notes", notes),
+		widget.NewFormItem("Takings", takings),
+	}
+	dlg := dialog.NewForm("Close Shift", "Save Report", "Cancel", items, func(ok bool) {
+		if !ok {
+			return
+		}
+		var amount float64
+		if t := strings.TrimSpace(takings.Text); t != "" {
+			if _, err := fmt.Sscanf(t, "%f", &amount); err != nil {
+				dialog.ShowError(fmt.Errorf("takings must be a number"), mainWindow)
+				return
+			}
+		}
+		rep, err := buildShiftReport(start, time.Now())
+		if err != nil {
+			dialog.ShowError(err, mainWindow)
+			return
+		}
+		rep.ClosedBy = actingStaff()
+		rep.Incidents = strings.TrimSpace(incidents.Text)
+		rep.Notes = strings.TrimSpace(notes.Text)
+		rep.Takings = amount
+		p, err := saveShiftReport(rep)
+		recordAudit(actingStaff(), auditShiftClose, filepath.Base(p), nil, map[string]int{
+			"started": len(rep.Started), "ended": len(rep.Ended), "active": len(rep.Active), "queue": len(rep.Queue),
+		}, err)
+		if err != nil {
+			dialog.ShowError(err, mainWindow)
+			return
+		}
+		// The outgoing attendant is done; the next one signs in.
+		lockScreen()
+	}, mainWindow)
+	dlg.Resize(fyne.NewSize(520, 420))
+	dlg.Show()
+}
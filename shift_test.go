@@ -0,0 +1,28 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// TestShiftReportSessionAcrossMidnight ends a session in the shift that was
+// logged in the previous day's file.
+func TestShiftReportSessionAcrossMidnight(t *testing.T) {
+	setupTestLounge(t)
+	today := startOfDay(time.Now())
+	in, out := today.Add(-time.Hour), today.Add(time.Hour)
+	e := LogEntry{UserName: "Ann", UserID: "a1", PCID: 3, CheckInTime: in, CheckOutTime: out}
+	if err := writeLogEntriesFile(logFilePathForDate(in), []LogEntry{e}); err != nil {
+		t.Fatal(err)
+	}
+	rep, err := buildShiftReport(today, today.Add(2*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rep.Ended) != 1 || rep.Ended[0].UserID != "a1" || rep.Ended[0].Duration != 2*time.Hour {
+		t.Fatalf("ended %+v, want Ann's two-hour session", rep.Ended)
+	}
+	if len(rep.Started) != 0 {
+		t.Fatalf("started %+v, want none", rep.Started)
+	}
+}
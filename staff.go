@@ -0,0 +1,478 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+)
+
+// ---------- Staff accounts ----------
+//
+// Staff sign in with their ID and PIN. Until the first account is created in
+// the Staff dialog nobody has to sign in and every action is allowed, which
+// keeps existing installs working.
+
+const staffFile = "log/staff.json"
+
+const (
+	RoleAttendant  = "attendant"
+	RoleSupervisor = "supervisor"
+	RoleAdmin      = "admin"
+)
+
+var staffRoles = []string{RoleAttendant, RoleSupervisor, RoleAdmin}
+
+var roleRank = map[string]int{RoleAttendant: 1, RoleSupervisor: 2, RoleAdmin: 3}
+
+// Actor names recorded in the log for operations that no signed-in staff
+// member performed.
+const (
+	actorKiosk = "kiosk"
+	actorAPI   = "api"
+	actorCLI   = "cli"
+)
+
+// Permissions for destructive actions and the lowest role that has them.
+const (
+	permLogEdit   = "log_edit" // includes undoing another person's operation
+	permSettings  = "settings" // includes managing staff accounts
+	permAuditView = "audit_view"
+	permPower     = "power"     // waking and shutting down PCs
+	permLayout    = "layout"    // rearranging the floor plan
+	permEvents    = "events"    // adding, ending and deleting events
+	permEquipment = "equipment" // adding and retiring items; lending is open to all
+)
+
+var permissionRole = map[string]string{
+	permLogEdit:   RoleSupervisor,
+	permSettings:  RoleAdmin,
+	permAuditView: RoleSupervisor,
+	permPower:     RoleSupervisor,
+	permLayout:    RoleSupervisor,
+	permEvents:    RoleSupervisor,
+	permEquipment: RoleSupervisor,
+}
+
+const (
+	pinHashRounds     = 100000
+	maxLoginFailures  = 5
+	loginFailureDelay = 30 * time.Second
+)
+
+type Staff struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Role    string `json:"role"`
+	PINSalt string `json:"pin_salt"`
+	PINHash string `json:"pin_hash"`
+}
+
+// The staff list and the signed-in member belong to the Fyne thread.
+var (
+	staffAccounts []Staff
+	currentStaff  *Staff
+
+	staffLabel        *widget.Label
+	lockSavedContent  fyne.CanvasObject
+	loginFailures     int
+	loginBlockedUntil time.Time
+)
+
+func loadStaff() error {
+	var list []Staff
+	err := withDataLock(func() error {
+		b, err := os.ReadFile(staffFile)
+		if os.IsNotExist(err) || (err == nil && len(b) == 0) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("read staff: %w", err)
+		}
+		if err := json.Unmarshal(b, &list); err != nil {
+			return fmt.Errorf("unmarshal %s: %w", staffFile, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	staffAccounts = list
+	return nil
+}
+
+func saveStaff() error {
+	data, err := json.MarshalIndent(staffAccounts, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal staff: %w", err)
+	}
+	return withDataLock(func() error { return os.WriteFile(staffFile, data, 0o600) })
+}
+
+func hashPIN(salt, pin string) string {
+	sum := sha256.Sum256([]byte(salt + ":" + pin))
+	for i := 0; i < pinHashRounds; i++ {
+		sum = sha256.Sum256(append(sum[:], salt...))
+	}
+	return hex.EncodeToString(sum[:])
+}
+
+func setStaffPIN(s *Staff, pin string) error {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return err
+	}
+	s.PINSalt = hex.EncodeToString(salt)
+	s.PINHash = hashPIN(s.PINSalt, pin)
+	return nil
+}
+
+func validPIN(pin string) bool {
+	if len(pin) < 4 || len(pin) > 12 {
+		return false
+	}
+	for _, r := range pin {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func staffByID(id string) *Staff {
+	for i := range staffAccounts {
+		if strings.EqualFold(staffAccounts[i].ID, id) {
+			return &staffAccounts[i]
+		}
+	}
+	return nil
+}
+
+func staffEnabled() bool { return len(staffAccounts) > 0 }
+
+// verifyStaffPIN returns the account for a staff ID and PIN. Failures count
+// towards the lockout shared by the lock screen and the kiosk exit.
+func verifyStaffPIN(id, pin string) (*Staff, error) {
+	if wait := time.Until(loginBlockedUntil); wait > 0 {
+		return nil, fmt.Errorf("too many attempts, try again in %d seconds", int(wait.Seconds())+1)
+	}
+	if err := loadStaff(); err != nil {
+		fmt.Println("Error loading staff:", err)
+	}
+	s := staffByID(strings.TrimSpace(id))
+	if s == nil || subtle.ConstantTimeCompare([]byte(hashPIN(s.PINSalt, pin)), []byte(s.PINHash)) != 1 {
+		loginFailures++
+		if loginFailures >= maxLoginFailures {
+			loginFailures = 0
+			loginBlockedUntil = time.Now().Add(loginFailureDelay)
+		}
+		return nil, fmt.Errorf("unknown staff ID or wrong PIN")
+	}
+	loginFailures = 0
+	return s, nil
+}
+
+// actingStaff is the actor recorded for the signed-in staff member's actions.
+func actingStaff() string {
+	if currentStaff == nil {
+		return ""
+	}
+	return currentStaff.ID
+}
+
+func staffAllowed(perm string) bool {
+	if !staffEnabled() {
+		return true
+	}
+	if currentStaff == nil {
+		return false
+	}
+	return roleRank[currentStaff.Role] >= roleRank[permissionRole[perm]]
+}
+
+// requirePermission reports whether the signed-in staff member may do what,
+// telling them who can when they may not.
+func requirePermission(perm, what string) bool {
+	if err := permissionError(perm, what); err != nil {
+		dialog.ShowError(err, mainWindow)
+		return false
+	}
+	return true
+}
+
+// permissionError is requirePermission without the dialog: nil when allowed,
+// otherwise the audited refusal.
+func permissionError(perm, what string) error {
+	if staffAllowed(perm) {
+		return nil
+	}
+	err := fmt.Errorf("only a %s or above can %s", permissionRole[perm], what)
+	recordAudit(actingStaff(), auditDenied, perm, nil, nil, err)
+	return err
+}
+
+func staffLocked() bool { return lockSavedContent != nil }
+
+// ---------- Lock screen ----------
+
+// lockScreen signs the current staff member out and hides the window behind
+// the PIN screen.
+func lockScreen() {
+	if !staffEnabled() || mainWindow == nil || kioskActive || staffLocked() {
+		return
+	}
+	if currentStaff != nil {
+		recordAudit(currentStaff.ID, auditLock, currentStaff.ID, nil, nil, nil)
+	}
+	currentStaff = nil
+	updateStaffLabel()
+	lockSavedContent = mainWindow.Content()
+	mainWindow.SetContent(buildLockContent())
+}
+
+func unlockAs(s Staff) {
+	currentStaff = &s
+	loginFailures = 0
+	mainWindow.SetContent(lockSavedContent)
+	lockSavedContent = nil
+	updateStaffLabel()
+}
+
+func updateStaffLabel() {
+	if staffLabel == nil {
+		return
+	}
+	switch {
+	case currentStaff != nil:
+		staffLabel.SetText(fmt.Sprintf("%s (%s)", currentStaff.Name, currentStaff.Role))
+	case staffEnabled():
+		staffLabel.SetText("Signed out")
+	default:
+		staffLabel.SetText("")
+	}
+}
+
+func buildLockContent() fyne.CanvasObject {
+	title := canvas.NewText("Lounge Locked", theme.ForegroundColor())
+	title.TextSize = 32
+	title.TextStyle.Bold = true
+	title.Alignment = fyne.TextAlignCenter
+
+	message := widget.NewLabel("Sign in with your staff ID and PIN.")
+	message.Alignment = fyne.TextAlignCenter
+
+	idEntry := widget.NewEntry()
+	idEntry.SetPlaceHolder("Staff ID")
+	pinEntry := widget.NewPasswordEntry()
+	pinEntry.SetPlaceHolder("PIN")
+
+	signIn := func() {
+		id := strings.TrimSpace(idEntry.Text)
+		s, err := verifyStaffPIN(id, pinEntry.Text)
+		pinEntry.SetText("")
+		if err != nil {
+			recordAudit(id, auditLoginFailed, id, nil, nil, err)
+			message.SetText(strings.ToUpper(err.Error()[:1]) + err.Error()[1:] + ".")
+			return
+		}
+		recordAudit(s.ID, auditLogin, s.ID, nil, nil, nil)
+		unlockAs(*s)
+	}
+	idEntry.OnSubmitted = func(string) { mainWindow.Canvas().Focus(pinEntry) }
+	pinEntry.OnSubmitted = func(string) { signIn() }
+	button := widget.NewButtonWithIcon("Sign In", theme.LoginIcon(), signIn)
+	button.Importance = widget.HighImportance
+
+	form := container.New(&leftRatioLayout{ratio: 1, minW: 320, maxW: 320},
+		container.NewVBox(idEntry, pinEntry, button))
+	body := container.NewVBox(title, message, container.NewCenter(form))
+	if mainWindow != nil {
+		mainWindow.Canvas().Focus(idEntry)
+	}
+	return container.NewCenter(body)
+}
+
+// ---------- Staff management ----------
+
+func showStaffDialog() {
+	if !requirePermission(permSettings, "manage staff accounts") {
+		return
+	}
+	if err := loadStaff(); err != nil {
+		dialog.ShowError(err, mainWindow)
+		return
+	}
+
+	selected := -1
+	list := widget.NewList(
+		func() int { return len(staffAccounts) },
+		func() fyne.CanvasObject { return widget.NewLabel("") },
+		func(i widget.ListItemID, o fyne.CanvasObject) {
+			s := staffAccounts[i]
+			o.(*widget.Label).SetText(fmt.Sprintf("%s (%s) - %s", s.Name, s.ID, s.Role))
+		},
+	)
+
+	idEntry := widget.NewEntry()
+	idEntry.SetPlaceHolder("Staff ID")
+	nameEntry := widget.NewEntry()
+	nameEntry.SetPlaceHolder("Name")
+	roleSelect := widget.NewSelect(staffRoles, nil)
+	roleSelect.SetSelected(RoleAttendant)
+	if !staffEnabled() {
+		roleSelect.SetSelected(RoleAdmin)
+	}
+	pinEntry := widget.NewPasswordEntry()
+	pinEntry.SetPlaceHolder("4-12 digits (blank keeps the current PIN)")
+
+	list.OnSelected = func(i widget.ListItemID) {
+		selected = i
+		s := staffAccounts[i]
+		idEntry.SetText(s.ID)
+		nameEntry.SetText(s.Name)
+		roleSelect.SetSelected(s.Role)
+		pinEntry.SetText("")
+	}
+
+	save := widget.NewButtonWithIcon("Save", theme.DocumentSaveIcon(), func() {
+		err := saveStaffMember(strings.TrimSpace(idEntry.Text), strings.TrimSpace(nameEntry.Text), roleSelect.Selected, pinEntry.Text)
+		if err != nil {
+			dialog.ShowError(err, mainWindow)
+			return
+		}
+		pinEntry.SetText("")
+		list.UnselectAll()
+		list.Refresh()
+		updateStaffLabel()
+	})
+	remove := widget.NewButtonWithIcon("Remove", theme.DeleteIcon(), func() {
+		if selected < 0 || selected >= len(staffAccounts) {
+			return
+		}
+		if err := removeStaffMember(staffAccounts[selected].ID); err != nil {
+			dialog.ShowError(err, mainWindow)
+			return
+		}
+		selected = -1
+		list.UnselectAll()
+		list.Refresh()
+		updateStaffLabel()
+	})
+	remove.Importance = widget.DangerImportance
+
+	form := widget.NewForm(
+		widget.NewFormItem("ID", idEntry),
+		widget.NewFormItem("Name", nameEntry),
+		widget.NewFormItem("Role", roleSelect),
+		widget.NewFormItem("PIN", pinEntry),
+	)
+	scroll := container.NewScroll(list)
+	scroll.SetMinSize(fyne.NewSize(0, 160))
+	content := container.NewVBox(scroll, form, container.NewHBox(save, remove))
+	dlg := dialog.NewCustom("Staff Accounts", "Close", content, mainWindow)
+	dlg.Resize(fyne.NewSize(480, dlg.MinSize().Height))
+	dlg.Show()
+}
+
+// saveStaffMember adds or updates an account. The first account must be an
+// admin so someone can always manage the rest.
+func saveStaffMember(id, name, role, pin string) (err error) {
+	actor := actingStaff()
+	before := staffAuditRecord(id, false)
+	defer func() { recordAudit(actor, auditStaffSave, id, before, staffAuditRecord(id, pin != ""), err) }()
+	if id == "" || name == "" {
+		return fmt.Errorf("staff ID and name are required")
+	}
+	if _, ok := roleRank[role]; !ok {
+		return fmt.Errorf("unknown role %q", role)
+	}
+	s := staffByID(id)
+	if s == nil {
+		if !staffEnabled() && role != RoleAdmin {
+			return fmt.Errorf("the first staff account must be an admin")
+		}
+		if !validPIN(pin) {
+			return fmt.Errorf("PIN must be 4-12 digits")
+		}
+		staffAccounts = append(staffAccounts, Staff{ID: id})
+		s = &staffAccounts[len(staffAccounts)-1]
+	} else if role != RoleAdmin && s.Role == RoleAdmin && countAdmins() == 1 {
+		return fmt.Errorf("%s is the last admin", s.Name)
+	}
+	s.Name, s.Role = name, role
+	if pin != "" {
+		if !validPIN(pin) {
+			return fmt.Errorf("PIN must be 4-12 digits")
+		}
+		if err := setStaffPIN(s, pin); err != nil {
+			return err
+		}
+	}
+	sort.Slice(staffAccounts, func(i, j int) bool { return staffAccounts[i].ID < staffAccounts[j].ID })
+	if currentStaff == nil && len(staffAccounts) == 1 {
+		// Whoever creates the first account is signed in as it.
+		first := staffAccounts[0]
+		currentStaff = &first
+	} else if currentStaff != nil && strings.EqualFold(currentStaff.ID, id) {
+		updated := *staffByID(id)
+		currentStaff = &updated
+	}
+	return saveStaff()
+}
+
+func removeStaffMember(id string) (err error) {
+	before := staffAuditRecord(id, false)
+	defer func() { recordAudit(actingStaff(), auditStaffRemove, id, before, nil, err) }()
+	for i, s := range staffAccounts {
+		if s.ID != id {
+			continue
+		}
+		if s.Role == RoleAdmin && countAdmins() == 1 {
+			return fmt.Errorf("%s is the last admin", s.Name)
+		}
+		if currentStaff != nil && currentStaff.ID == s.ID {
+			return fmt.Errorf("you cannot remove your own account")
+		}
+		staffAccounts = append(staffAccounts[:i], staffAccounts[i+1:]...)
+		return saveStaff()
+	}
+	return fmt.Errorf("staff ID %s not found", id)
+}
+
+// staffAuditRecord is what the audit log keeps of an account: never the PIN
+// hash, only whether the PIN was changed.
+func staffAuditRecord(id string, pinChanged bool) any {
+	s := staffByID(id)
+	if s == nil {
+		return nil
+	}
+	return struct {
+		ID         string `json:"id"`
+		Name       string `json:"name"`
+		Role       string `json:"role"`
+		PINChanged bool   `json:"pin_changed,omitempty"`
+	}{s.ID, s.Name, s.Role, pinChanged}
+}
+
+func countAdmins() int {
+	n := 0
+	for _, s := range staffAccounts {
+		if s.Role == RoleAdmin {
+			n++
+		}
+	}
+	return n
+}
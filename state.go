@@ -0,0 +1,114 @@
+package main
+
+import (
+	"strings"
+	"sync"
+)
+
+// ---------- State ownership ----------
+//
+// activeUsers, allDevices, members and the saved-data bookkeeping have one
+// owner: stateMu. The mutations (registerUser, checkoutUser, ...) take it
+// themselves and call their *Locked variants; everything else reads through
+// a snapshot or runs inside withState. currentLogEntries is separate: it
+// belongs to the Fyne thread and is only set there (see showLogEntries).
+
+var stateMu sync.Mutex
+
+// withState runs fn holding the state lock. fn must not call a mutation that
+// takes the lock itself; use the *Locked variant instead.
+func withState(fn func()) {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	fn()
+}
+
+// stateSnapshot is a copy of the lounge state for views to read without
+// holding the lock.
+type stateSnapshot struct {
+	Devices     []Device
+	Users       []User
+	Tournaments []Tournament
+}
+
+func snapshotState() stateSnapshot {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	return stateSnapshot{
+		Devices:     append([]Device{}, allDevices...),
+		Users:       append([]User{}, activeUsers...),
+		Tournaments: append([]Tournament{}, tournaments...),
+	}
+}
+
+func snapshotMembers() []Member {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	return append([]Member{}, members...)
+}
+
+func (s stateSnapshot) user(id string) *User {
+	for i := range s.Users {
+		if s.Users[i].ID == id {
+			return &s.Users[i]
+		}
+	}
+	return nil
+}
+
+func (s stateSnapshot) device(id int) *Device {
+	for i := range s.Devices {
+		if s.Devices[i].ID == id {
+			return &s.Devices[i]
+		}
+	}
+	return nil
+}
+
+func (s stateSnapshot) usersOn(deviceID int) []User {
+	out := []User{}
+	for _, u := range s.Users {
+		if u.PCID == deviceID {
+			out = append(out, u)
+		}
+	}
+	return out
+}
+
+func (s stateSnapshot) pending() []User { return s.usersOn(0) }
+
+// waitingFor counts the queued users who asked for deviceType or for any
+// device; "" counts the whole queue.
+func (s stateSnapshot) waitingFor(deviceType string) int {
+	n := 0
+	for _, u := range s.pending() {
+		if deviceType == "" || u.WantType == "" || strings.EqualFold(u.WantType, deviceType) {
+			n++
+		}
+	}
+	return n
+}
+
+// deviceTypes lists the lounge's device types in the order they first
+// appear, for the "wants" choice when queueing.
+func (s stateSnapshot) deviceTypes() []string {
+	var types []string
+	seen := map[string]bool{}
+	for _, d := range s.Devices {
+		if !seen[d.Type] {
+			seen[d.Type] = true
+			types = append(types, d.Type)
+		}
+	}
+	return types
+}
+
+// queuePosition is 1-based; 0 means the user is not queued.
+func (s stateSnapshot) queuePosition(userID string) int {
+	for i, u := range s.pending() {
+		if u.ID == userID {
+			return i + 1
+		}
+	}
+	return 0
+}
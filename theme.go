@@ -22,6 +22,7 @@ var (
 	latteAccent    = color.NRGBA{R: 136, G: 57, B: 239, A: 255}  // mauve
 	latteGreen     = color.NRGBA{R: 64, G: 160, B: 43, A: 255}   // green
 	latteRed       = color.NRGBA{R: 210, G: 15, B: 57, A: 255}   // red
+	latteYellow    = color.NRGBA{R: 223, G: 142, B: 29, A: 255}  // yellow
 )
 
 type catppuccinLatteTheme struct{ fyne.Theme }
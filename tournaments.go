@@ -0,0 +1,522 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/layout"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+)
+
+// ---------- Tournaments and events ----------
+//
+// An event (a tournament, a class booking, ...) holds a set of devices for a
+// time window. While it runs those devices are reserved: walk-ins cannot be
+// checked in, queued or switched onto them, and participants check in
+// against the event so the report can tell event play from casual play.
+// Events are kept in log/tournaments.json and belong to stateMu like the
+// rest of the lounge state; another desk's changes arrive with syncFromDisk.
+
+const tournamentFile = "log/tournaments.json"
+
+const (
+	auditTournamentAdd    = "event_add"
+	auditTournamentEnd    = "event_end"
+	auditTournamentDelete = "event_delete"
+)
+
+var errDeviceReserved = errors.New("device reserved for an event")
+
+type Tournament struct {
+	ID      string    `json:"id"`
+	Name    string    `json:"name"`
+	Devices []int     `json:"devices"`
+	Start   time.Time `json:"start"`
+	End     time.Time `json:"end"`
+}
+
+func (t Tournament) activeAt(now time.Time) bool {
+	return !now.Before(t.Start) && now.Before(t.End)
+}
+
+func (t Tournament) hasDevice(id int) bool {
+	for _, d := range t.Devices {
+		if d == id {
+			return true
+		}
+	}
+	return false
+}
+
+func (t Tournament) window() string {
+	end := t.End.Format("15:04")
+	if t.End.YearDay() != t.Start.YearDay() || t.End.Year() != t.Start.Year() {
+		end = t.End.Format("Mon Jan 02 15:04")
+	}
+	return t.Start.Format("Mon Jan 02 15:04") + "-" + end
+}
+
+var (
+	tournaments     []Tournament // guarded by stateMu
+	tournamentStamp string
+)
+
+// reservationIn returns the event holding deviceID at now, if any.
+func reservationIn(list []Tournament, deviceID int, now time.Time) *Tournament {
+	for i := range list {
+		if list[i].activeAt(now) && list[i].hasDevice(deviceID) {
+			return &list[i]
+		}
+	}
+	return nil
+}
+
+// reservationLocked is reservationIn on the live list; call holding the
+// state lock.
+func reservationLocked(deviceID int, now time.Time) *Tournament {
+	return reservationIn(tournaments, deviceID, now)
+}
+
+func (s stateSnapshot) reservation(deviceID int, now time.Time) *Tournament {
+	return reservationIn(s.Tournaments, deviceID, now)
+}
+
+func tournamentByID(id string) *Tournament {
+	for i := range tournaments {
+		if tournaments[i].ID == id {
+			return &tournaments[i]
+		}
+	}
+	return nil
+}
+
+// checkReservationLocked lets participants of a running event onto its
+// devices and keeps everyone else off them.
+func checkReservationLocked(deviceID int, tournamentID string, now time.Time) error {
+	if tournamentID != "" {
+		t := tournamentByID(tournamentID)
+		switch {
+		case t == nil:
+			return fmt.Errorf("no event %q", tournamentID)
+		case !t.activeAt(now):
+			return fmt.Errorf("%s is not running now (%s)", t.Name, t.window())
+		case !t.hasDevice(deviceID):
+			return fmt.Errorf("device %d is not one of %s's devices", deviceID, t.Name)
+		}
+		return nil
+	}
+	if t := reservationLocked(deviceID, now); t != nil {
+		return fmt.Errorf("%w: device %d is held for %s until %s", errDeviceReserved, deviceID, t.Name, t.End.Format("15:04"))
+	}
+	return nil
+}
+
+// ---------- Event storage ----------
+
+func readTournamentFile() ([]Tournament, error) {
+	var list []Tournament
+	b, err := os.ReadFile(tournamentFile)
+	if os.IsNotExist(err) || (err == nil && len(b) == 0) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read events: %w", err)
+	}
+	if err := json.Unmarshal(b, &list); err != nil {
+		return nil, fmt.Errorf("unmarshal %s: %w", tournamentFile, err)
+	}
+	return list, nil
+}
+
+// loadTournaments reads the events if the file changed since the last read
+// and reports whether it did. Call holding the state lock.
+func loadTournaments() (changed bool, err error) {
+	err = withDataLock(func() error {
+		stamp := fileStamp(tournamentFile)
+		if stamp == tournamentStamp {
+			return nil
+		}
+		list, err := readTournamentFile()
+		if err != nil {
+			return err
+		}
+		tournaments, tournamentStamp, changed = list, stamp, true
+		return nil
+	})
+	return changed, err
+}
+
+// updateTournaments applies fn to the events on disk, so another desk's
+// edits are not lost, and saves the result. Call holding the state lock.
+func updateTournaments(fn func(list []Tournament) ([]Tournament, error)) error {
+	return withDataLock(func() error {
+		list, err := readTournamentFile()
+		if err != nil {
+			return err
+		}
+		if list, err = fn(list); err != nil {
+			return err
+		}
+		data, err := json.MarshalIndent(list, "", "  ")
+		if err != nil {
+			return fmt.Errorf("marshal events: %w", err)
+		}
+		tmp := tournamentFile + ".tmp"
+		if err := os.WriteFile(tmp, data, 0o644); err != nil {
+			return err
+		}
+		if err := os.Rename(tmp, tournamentFile); err != nil {
+			return err
+		}
+		tournaments, tournamentStamp = list, fileStamp(tournamentFile)
+		return nil
+	})
+}
+
+// ---------- Event mutations ----------
+
+func addTournament(t Tournament, by string) (Tournament, error) {
+	t.Name = strings.TrimSpace(t.Name)
+	switch {
+	case t.Name == "":
+		return t, fmt.Errorf("an event name is required")
+	case !t.End.After(t.Start):
+		return t, fmt.Errorf("the event must end after it starts")
+	case len(t.Devices) == 0:
+		return t, fmt.Errorf("an event needs at least one device")
+	}
+	stateMu.Lock()
+	for _, id := range t.Devices {
+		if getDeviceByID(id) == nil {
+			stateMu.Unlock()
+			return t, fmt.Errorf("device ID %d does not exist", id)
+		}
+	}
+	err := updateTournaments(func(list []Tournament) ([]Tournament, error) {
+		for _, o := range list {
+			if !t.Start.Before(o.End) || !o.Start.Before(t.End) {
+				continue
+			}
+			for _, id := range t.Devices {
+				if o.hasDevice(id) {
+					return nil, fmt.Errorf("device %d is already held for %s (%s)", id, o.Name, o.window())
+				}
+			}
+		}
+		max := 0
+		for _, o := range list {
+			if n, err := strconv.Atoi(o.ID); err == nil && n > max {
+				max = n
+			}
+		}
+		t.ID = strconv.Itoa(max + 1)
+		return append(list, t), nil
+	})
+	stateMu.Unlock()
+	recordAudit(by, auditTournamentAdd, t.ID, nil, t, err)
+	if err == nil {
+		publishEvent(LoungeEvent{Type: EventTournament, Message: fmt.Sprintf("%s added (%s)", t.Name, t.window())})
+	}
+	return t, err
+}
+
+// endTournament releases an event's devices now; events that have not
+// started are deleted instead, since no one played in them.
+func endTournament(id, by string) (err error) {
+	now := time.Now()
+	var before, after *Tournament
+	stateMu.Lock()
+	err = updateTournaments(func(list []Tournament) ([]Tournament, error) {
+		for i := range list {
+			if list[i].ID != id {
+				continue
+			}
+			b := list[i]
+			before = &b
+			if now.Before(list[i].Start) {
+				return append(list[:i], list[i+1:]...), nil
+			}
+			if !now.Before(list[i].End) {
+				return nil, fmt.Errorf("%s is already over", list[i].Name)
+			}
+			list[i].End = now
+			a := list[i]
+			after = &a
+			return list, nil
+		}
+		return nil, fmt.Errorf("no event %q", id)
+	})
+	stateMu.Unlock()
+	action := auditTournamentEnd
+	if after == nil {
+		action = auditTournamentDelete
+	}
+	recordAudit(by, action, id, before, after, err)
+	if err == nil {
+		msg := before.Name + " ended"
+		if after == nil {
+			msg = before.Name + " deleted"
+		}
+		publishEvent(LoungeEvent{Type: EventTournament, Message: msg})
+	}
+	return err
+}
+
+// ---------- Event usage ----------
+
+type eventUsage struct {
+	ID       string  `json:"id"`
+	Name     string  `json:"name"`
+	Sessions int     `json:"sessions"`
+	Hours    float64 `json:"hours"`
+}
+
+// eventUsageFor totals the finished sessions' time played in an event, in
+// event start order, and returns the hours they add up to.
+func eventUsageFor(entries []LogEntry, list []Tournament) ([]eventUsage, float64) {
+	byID := map[string]*eventUsage{}
+	total := 0.0
+	for _, e := range entries {
+		if e.PCID == 0 || e.CheckOutTime.IsZero() {
+			continue
+		}
+		counted := map[string]bool{}
+		for _, s := range e.segments() {
+			if s.Tournament == "" {
+				continue
+			}
+			eu := byID[s.Tournament]
+			if eu == nil {
+				eu = &eventUsage{ID: s.Tournament, Name: "event " + s.Tournament}
+				byID[s.Tournament] = eu
+			}
+			if !counted[s.Tournament] {
+				counted[s.Tournament] = true
+				eu.Sessions++
+			}
+			eu.Hours += s.hours()
+			total += s.hours()
+		}
+	}
+	out := []eventUsage{}
+	for _, t := range list {
+		if eu := byID[t.ID]; eu != nil {
+			eu.Name = t.Name
+			out = append(out, *eu)
+			delete(byID, t.ID)
+		}
+	}
+	for _, eu := range byID { // events no longer on file
+		out = append(out, *eu)
+	}
+	return out, total
+}
+
+// ---------- Event clock ----------
+
+var activeTournamentIDs string // Fyne thread only
+
+// checkTournaments redraws the floor plan when an event starts or ends.
+// Fyne thread only.
+func checkTournaments(now time.Time) {
+	var ids []string
+	for _, t := range snapshotState().Tournaments {
+		if t.activeAt(now) {
+			ids = append(ids, t.ID)
+		}
+	}
+	if key := strings.Join(ids, ","); key != activeTournamentIDs {
+		activeTournamentIDs = key
+		notifyLocal(LoungeEvent{Type: EventTournament})
+	}
+}
+
+// ---------- Device lists ----------
+
+// parseDeviceList reads "1-8, 17" into device IDs.
+func parseDeviceList(s string) ([]int, error) {
+	var ids []int
+	seen := map[int]bool{}
+	for _, part := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ' ' }) {
+		lo, hi, isRange := strings.Cut(part, "-")
+		a, err := strconv.Atoi(lo)
+		if err != nil {
+			return nil, fmt.Errorf("invalid device %q", part)
+		}
+		b := a
+		if isRange {
+			if b, err = strconv.Atoi(hi); err != nil || b < a {
+				return nil, fmt.Errorf("invalid device range %q", part)
+			}
+		}
+		for id := a; id <= b; id++ {
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+	sort.Ints(ids)
+	return ids, nil
+}
+
+// formatDeviceList is the inverse of parseDeviceList.
+func formatDeviceList(ids []int) string {
+	var parts []string
+	for i := 0; i < len(ids); {
+		j := i
+		for j+1 < len(ids) && ids[j+1] == ids[j]+1 {
+			j++
+		}
+		if j > i {
+			parts = append(parts, fmt.Sprintf("%d-%d", ids[i], ids[j]))
+		} else {
+			parts = append(parts, strconv.Itoa(ids[i]))
+		}
+		i = j + 1
+	}
+	return strings.Join(parts, ", ")
+}
+
+// parseEventTimes reads a day (YYYY-MM-DD) and start and end clock times;
+// an end at or before the start is on the next day.
+func parseEventTimes(day, start, end string) (time.Time, time.Time, error) {
+	d, err := time.ParseInLocation("2006-01-02", strings.TrimSpace(day), time.Local)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid date %q: use YYYY-MM-DD", day)
+	}
+	s, err := parseClock(strings.TrimSpace(start))
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	e, err := parseClock(strings.TrimSpace(end))
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	from, to := d.Add(s), d.Add(e)
+	if !to.After(from) {
+		to = to.AddDate(0, 0, 1)
+	}
+	return from, to, nil
+}
+
+// ---------- Events dialog ----------
+
+func showTournamentsDialog() {
+	var list []Tournament
+	var selected = -1
+	var rows *widget.List
+
+	reload := func() {
+		now := time.Now()
+		list = list[:0]
+		for _, t := range snapshotState().Tournaments {
+			if now.Before(t.End) {
+				list = append(list, t)
+			}
+		}
+		sort.Slice(list, func(i, j int) bool { return list[i].Start.Before(list[j].Start) })
+		selected = -1
+		if rows != nil {
+			rows.UnselectAll()
+			rows.Refresh()
+		}
+	}
+	reload()
+
+	rows = widget.NewList(
+		func() int { return len(list) },
+		func() fyne.CanvasObject { return widget.NewLabel("") },
+		func(i widget.ListItemID, o fyne.CanvasObject) {
+			t := list[i]
+			l := o.(*widget.Label)
+			state := ""
+			l.TextStyle.Bold = t.activeAt(time.Now())
+			if l.TextStyle.Bold {
+				state = " - running"
+			}
+			l.SetText(fmt.Sprintf("%s: %s, devices %s%s", t.Name, t.window(), formatDeviceList(t.Devices), state))
+		})
+	rows.OnSelected = func(i widget.ListItemID) { selected = i }
+	rows.OnUnselected = func(widget.ListItemID) { selected = -1 }
+
+	add := widget.NewButtonWithIcon("New Event...", theme.ContentAddIcon(), func() {
+		if requirePermission(permEvents, "add events") {
+			showAddTournamentDialog(reload)
+		}
+	})
+	end := widget.NewButtonWithIcon("End / Delete", theme.MediaStopIcon(), func() {
+		if selected < 0 || selected >= len(list) || !requirePermission(permEvents, "end or delete events") {
+			return
+		}
+		t := list[selected]
+		q := fmt.Sprintf("End %s now and release its devices?", t.Name)
+		if time.Now().Before(t.Start) {
+			q = fmt.Sprintf("Delete %s?", t.Name)
+		}
+		dialog.ShowConfirm("Event", q, func(ok bool) {
+			if !ok {
+				return
+			}
+			if err := endTournament(t.ID, actingStaff()); err != nil {
+				dialog.ShowError(err, mainWindow)
+			}
+			reload()
+		}, mainWindow)
+	})
+	note := widget.NewLabel("Participants check in by tapping one of the event's devices.")
+	note.Wrapping = fyne.TextWrapWord
+	buttons := container.NewHBox(add, end, layout.NewSpacer())
+	dlg := dialog.NewCustom("Events", "Close", container.NewBorder(note, buttons, nil, nil, rows), mainWindow)
+	dlg.Resize(fyne.NewSize(640, 420))
+	dlg.Show()
+}
+
+func showAddTournamentDialog(done func()) {
+	now := time.Now()
+	name := widget.NewEntry()
+	name.SetPlaceHolder("Friday Cup")
+	day := widget.NewEntry()
+	day.SetText(now.Format("2006-01-02"))
+	start := widget.NewEntry()
+	start.SetText("18:00")
+	end := widget.NewEntry()
+	end.SetText("22:00")
+	devices := widget.NewEntry()
+	devices.SetPlaceHolder("1-8, 17")
+	dialog.ShowForm("New Event", "Add", "Cancel", []*widget.FormItem{
+		widget.NewFormItem("Name", name),
+		widget.NewFormItem("Date", day),
+		widget.NewFormItem("Start", start),
+		widget.NewFormItem("End", end),
+		widget.NewFormItem("Devices", devices),
+	}, func(ok bool) {
+		if !ok {
+			return
+		}
+		from, to, err := parseEventTimes(day.Text, start.Text, end.Text)
+		if err != nil {
+			dialog.ShowError(err, mainWindow)
+			return
+		}
+		ids, err := parseDeviceList(devices.Text)
+		if err != nil {
+			dialog.ShowError(err, mainWindow)
+			return
+		}
+		if _, err := addTournament(Tournament{Name: name.Text, Devices: ids, Start: from, End: to}, actingStaff()); err != nil {
+			dialog.ShowError(err, mainWindow)
+		}
+		done()
+	}, mainWindow)
+}
@@ -0,0 +1,448 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/driver/desktop"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+)
+
+// ---------- Undo / redo ----------
+//
+// Every front-desk operation pushes an undoOp describing what happened to
+// each user it touched. Undo plays the steps backwards against the current
+// state and rewrites the matching log entries; redo plays them forwards
+// again. Both refuse, without changing anything, when the state has moved
+// on since (another desk, the kiosk, or a later operation).
+
+const maxUndoOps = 50
+
+type undoStepKind int
+
+const (
+	undoStepAdd    undoStepKind = iota // checked in or joined the queue
+	undoStepRemove                     // checked out or left the queue
+	undoStepMove                       // assigned from the queue or moved to another device
+)
+
+type undoStep struct {
+	Kind     undoStepKind
+	Before   User      // Remove, Move
+	After    User      // Add, Move
+	Index    int       // position in activeUsers (queue order) for Add and Remove
+	ClosedAt time.Time // Remove: when the log entry was closed; Move between devices: when it happened
+}
+
+type undoOp struct {
+	Label string
+	By    string // actor of the original operation
+	Steps []undoStep
+}
+
+var errNothingToUndo = errors.New("nothing to undo")
+var errNothingToRedo = errors.New("nothing to redo")
+
+// undoStack and redoStack are guarded by stateMu.
+var undoStack, redoStack []undoOp
+
+// recordUndo pushes op and forgets anything that could be redone. Call
+// holding the state lock.
+func recordUndo(op undoOp) {
+	undoStack = append(undoStack, op)
+	if len(undoStack) > maxUndoOps {
+		undoStack = undoStack[len(undoStack)-maxUndoOps:]
+	}
+	redoStack = nil
+}
+
+func indexOfUser(users []User, id string) int {
+	for i := range users {
+		if users[i].ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// deviceName is "PC 3" or "Console 17"; call holding the state lock.
+func deviceName(id int) string {
+	if id == 0 {
+		return "the queue"
+	}
+	if d := getDeviceByID(id); d != nil {
+		return fmt.Sprintf("%s %d", d.Type, id)
+	}
+	return fmt.Sprintf("device %d", id)
+}
+
+// replayAllowed lets staff replay their own operations; anyone else's needs
+// permLogEdit. It does not touch the UI, so it runs under the state lock.
+func replayAllowed(op undoOp) error {
+	if op.By != "" && op.By == actingStaff() {
+		return nil
+	}
+	return permissionError(permLogEdit, "undo or redo "+op.Label)
+}
+
+// lockSettled takes the state lock and flushes the log writer, so an undo
+// starts from a log that matches the state it reverts. Writes are queued
+// holding the lock, so none can slip in after the flush.
+func lockSettled() {
+	stateMu.Lock()
+	flushLogWrites()
+}
+
+func undoAvailable() (canUndo, canRedo bool) {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	return len(undoStack) > 0, len(redoStack) > 0
+}
+
+// undoLast reverts the most recent operation and returns its label; by is
+// who asked, for the audit log. allow, if set, may refuse the operation
+// before anything changes.
+func undoLast(by string, allow func(undoOp) error) (string, error) {
+	lockSettled()
+	defer stateMu.Unlock()
+	if len(undoStack) == 0 {
+		return "", errNothingToUndo
+	}
+	op := undoStack[len(undoStack)-1]
+	if allow != nil {
+		if err := allow(op); err != nil {
+			return "", err
+		}
+	}
+	if err := replayUndoOp(op, true, by); err != nil {
+		return "", fmt.Errorf("cannot undo %s: %w", op.Label, err)
+	}
+	undoStack = undoStack[:len(undoStack)-1]
+	redoStack = append(redoStack, op)
+	return op.Label, nil
+}
+
+// redoLast re-applies the most recently undone operation.
+func redoLast(by string, allow func(undoOp) error) (string, error) {
+	lockSettled()
+	defer stateMu.Unlock()
+	if len(redoStack) == 0 {
+		return "", errNothingToRedo
+	}
+	op := redoStack[len(redoStack)-1]
+	if allow != nil {
+		if err := allow(op); err != nil {
+			return "", err
+		}
+	}
+	if err := replayUndoOp(op, false, by); err != nil {
+		return "", fmt.Errorf("cannot redo %s: %w", op.Label, err)
+	}
+	redoStack = redoStack[:len(redoStack)-1]
+	undoStack = append(undoStack, op)
+	return op.Label, nil
+}
+
+// replayUndoOp checks every step against a copy of activeUsers first, so a
+// step that no longer fits leaves the state untouched.
+func replayUndoOp(op undoOp, backwards bool, by string) (err error) {
+	steps := make([]undoStep, len(op.Steps))
+	copy(steps, op.Steps)
+	if backwards {
+		for i, j := 0, len(steps)-1; i < j; i, j = i+1, j-1 {
+			steps[i], steps[j] = steps[j], steps[i]
+		}
+	}
+	evType := EventRedo
+	if backwards {
+		evType = EventUndo
+	}
+
+	var before, after []User
+	for _, st := range steps {
+		from, to := st.endpoints(backwards)
+		if from.ID != "" {
+			before = append(before, from)
+		}
+		if to.ID != "" {
+			after = append(after, to)
+		}
+	}
+	defer func() { recordAudit(by, evType, op.Label, before, after, err) }()
+
+	users := append([]User{}, activeUsers...)
+	for _, st := range steps {
+		if users, err = st.applyTo(users, backwards); err != nil {
+			return err
+		}
+	}
+	if err = checkPCsUnshared(users); err != nil {
+		return err
+	}
+	activeUsers = users
+	rebuildDeviceStatus()
+	saveData()
+
+	// The rewrite is queued behind the operation's own log writes, so the
+	// entries they created are there to rewrite.
+	queueLogWrite(func() error {
+		var errs []error
+		for _, st := range steps {
+			if err := st.rewriteLog(backwards, op.By); err != nil {
+				errs = append(errs, fmt.Errorf("rewriting log for undo: %w", err))
+			}
+		}
+		return errors.Join(errs...)
+	})
+	for _, st := range steps {
+		from, to := st.endpoints(backwards)
+		ev := LoungeEvent{Type: evType, UserID: to.ID, UserName: to.Name, DeviceID: to.PCID, FromDeviceID: from.PCID}
+		if to.ID == "" {
+			ev.UserID, ev.UserName = from.ID, from.Name
+		}
+		publishEvent(ev)
+	}
+	return nil
+}
+
+// endpoints returns the record the user must still match and what they
+// become; a zero User means absent.
+func (st undoStep) endpoints(backwards bool) (from, to User) {
+	switch st.Kind {
+	case undoStepAdd:
+		to = st.After
+	case undoStepRemove:
+		from = st.Before
+	default:
+		from, to = st.Before, st.After
+	}
+	if backwards {
+		from, to = to, from
+	}
+	return from, to
+}
+
+// applyTo plays one step against users.
+func (st undoStep) applyTo(users []User, backwards bool) ([]User, error) {
+	from, to := st.endpoints(backwards)
+
+	if from.ID != "" {
+		i := indexOfUser(users, from.ID)
+		if i < 0 || !sameUser(users[i], from) {
+			return nil, fmt.Errorf("%s (%s) has changed since", from.Name, from.ID)
+		}
+		if to.ID != "" { // move in place, keeping the queue order; see checkPCsUnshared
+			users[i] = to
+			return users, nil
+		}
+		return append(users[:i], users[i+1:]...), nil
+	}
+
+	if indexOfUser(users, to.ID) >= 0 {
+		return nil, fmt.Errorf("%s (%s) is already checked in", to.Name, to.ID)
+	}
+	if err := checkDeviceFree(users, to.PCID); err != nil {
+		return nil, err
+	}
+	idx := st.Index
+	if idx < 0 || idx > len(users) {
+		idx = len(users)
+	}
+	users = append(users[:idx], append([]User{to}, users[idx:]...)...)
+	return users, nil
+}
+
+// checkDeviceFree reports a PC that someone in users is already on; consoles
+// are shared and the queue (0) is always free.
+func checkDeviceFree(users []User, deviceID int) error {
+	if deviceID == 0 {
+		return nil
+	}
+	d := getDeviceByID(deviceID)
+	if d == nil {
+		return fmt.Errorf("device ID %d does not exist", deviceID)
+	}
+	if d.Type != "PC" {
+		return nil
+	}
+	for _, u := range users {
+		if u.PCID == deviceID {
+			return fmt.Errorf("PC %d is now used by %s (%s)", deviceID, u.Name, u.ID)
+		}
+	}
+	return nil
+}
+
+// checkPCsUnshared reports a PC that two of users are on. Moves are checked
+// this way, after all of an operation's steps, so a swap can be replayed.
+func checkPCsUnshared(users []User) error {
+	on := map[int]User{}
+	for _, u := range users {
+		if u.PCID == 0 {
+			continue
+		}
+		d := getDeviceByID(u.PCID)
+		if d == nil {
+			return fmt.Errorf("device ID %d does not exist", u.PCID)
+		}
+		if d.Type != "PC" {
+			continue
+		}
+		if other, ok := on[u.PCID]; ok {
+			return fmt.Errorf("PC %d is now used by %s (%s)", u.PCID, other.Name, other.ID)
+		}
+		on[u.PCID] = u
+	}
+	return nil
+}
+
+// rewriteLog makes the session's log entry match the step's outcome: undoing
+// a check-in deletes its entry, undoing a checkout reopens it, and so on.
+func (st undoStep) rewriteLog(backwards bool, by string) error {
+	session := st.Before
+	if st.Kind == undoStepAdd {
+		session = st.After
+	}
+	return editSessionLog(session, func(entries []LogEntry) []LogEntry {
+		i := findSessionEntry(entries, session)
+		switch {
+		case st.Kind == undoStepAdd && backwards:
+			if i >= 0 {
+				entries = append(entries[:i], entries[i+1:]...)
+			}
+		case st.Kind == undoStepAdd:
+			if i < 0 {
+				entries = applyLogEvent(entries, true, session, session.PCID, nil, by)
+			}
+		case i < 0:
+			fmt.Printf("No log entry for user %s (ID: %s) checked in at %s.\n", session.Name, session.ID, session.CheckInTime.Format("15:04:05"))
+		case st.Kind == undoStepRemove && backwards:
+			entries[i].CheckOutTime = time.Time{}
+			entries[i].UsageTime = ""
+			entries[i].CheckOutBy = ""
+			entries[i].AutoClosed = false
+			closeLastSegment(&entries[i])
+		case st.Kind == undoStepRemove:
+			entries[i].CheckOutTime = st.ClosedAt
+			entries[i].UsageTime = formatDuration(st.ClosedAt.Sub(entries[i].CheckInTime))
+			entries[i].CheckOutBy = by
+			closeLastSegment(&entries[i])
+		case st.Before.PCID != 0 && backwards:
+			revertLogMove(entries, st.Before)
+		case st.Before.PCID != 0:
+			var err error
+			if entries, err = applyLogMove(entries, st.After, st.ClosedAt, by); err != nil {
+				fmt.Println("Error updating daily log:", err)
+			}
+		case backwards:
+			entries[i].PCID = st.Before.PCID
+			entries[i].Game = st.Before.Game
+		default:
+			entries[i].PCID = st.After.PCID
+			entries[i].Game = st.After.Game
+		}
+		return entries
+	})
+}
+
+func findSessionEntry(entries []LogEntry, u User) int {
+	for i := len(entries) - 1; i >= 0; i-- {
+		if entries[i].UserID == u.ID && entries[i].CheckInTime.Equal(u.CheckInTime) {
+			return i
+		}
+	}
+	return -1
+}
+
+// editSessionLog rewrites the log file of the day the session started. Call
+// it from a queued log write (see queueLogWrite), not holding the state lock.
+func editSessionLog(u User, edit func([]LogEntry) []LogEntry) error {
+	return tryEditSessionLog(u, func(entries []LogEntry) ([]LogEntry, error) { return edit(entries), nil })
+}
+
+// tryEditSessionLog is editSessionLog for an edit that can fail; the file is
+// then left as it was.
+func tryEditSessionLog(u User, edit func([]LogEntry) ([]LogEntry, error)) error {
+	p := logFilePathForDate(u.CheckInTime)
+	logFileMutex.Lock()
+	defer logFileMutex.Unlock()
+	var entries []LogEntry
+	err := withDataLock(func() error {
+		var err error
+		if entries, err = readLogEntriesFile(p); err != nil {
+			return err
+		}
+		if entries, err = edit(entries); err != nil {
+			return err
+		}
+		return writeLogEntriesFile(p, entries)
+	})
+	if err == nil && p == getLogFilePath() {
+		showLogEntries(entries)
+	}
+	return err
+}
+
+// ---------- Undo toolbar & shortcuts ----------
+
+var undoButton, redoButton *widget.Button
+
+func buildUndoButtons() (*widget.Button, *widget.Button) {
+	undoButton = widget.NewButtonWithIcon("Undo", theme.ContentUndoIcon(), runUndo)
+	redoButton = widget.NewButtonWithIcon("Redo", theme.ContentRedoIcon(), runRedo)
+	refreshUndoButtons()
+	return undoButton, redoButton
+}
+
+// addUndoShortcuts binds Ctrl+Z to undo and Ctrl+Shift+Z / Ctrl+Y to redo
+// (Cmd on macOS).
+func addUndoShortcuts(c fyne.Canvas) {
+	mod := fyne.KeyModifierShortcutDefault
+	c.AddShortcut(&desktop.CustomShortcut{KeyName: fyne.KeyZ, Modifier: mod}, func(fyne.Shortcut) { runUndo() })
+	c.AddShortcut(&desktop.CustomShortcut{KeyName: fyne.KeyZ, Modifier: mod | fyne.KeyModifierShift}, func(fyne.Shortcut) { runRedo() })
+	c.AddShortcut(&desktop.CustomShortcut{KeyName: fyne.KeyY, Modifier: mod}, func(fyne.Shortcut) { runRedo() })
+}
+
+func refreshUndoButtons() {
+	if undoButton == nil {
+		return
+	}
+	canUndo, canRedo := undoAvailable()
+	setEnabled(undoButton, canUndo)
+	setEnabled(redoButton, canRedo)
+}
+
+func setEnabled(b *widget.Button, on bool) {
+	if on {
+		b.Enable()
+	} else {
+		b.Disable()
+	}
+}
+
+// runUndo and runRedo are ignored in kiosk mode and on the lock screen so
+// members cannot revert front-desk work. Undoing someone else's operation
+// rewrites their log entries and needs permLogEdit.
+func runUndo() {
+	if kioskActive || staffLocked() {
+		return
+	}
+	if _, err := undoLast(actingStaff(), replayAllowed); err != nil && !errors.Is(err, errNothingToUndo) {
+		dialog.ShowError(err, mainWindow)
+	}
+	refreshUndoButtons()
+}
+
+func runRedo() {
+	if kioskActive || staffLocked() {
+		return
+	}
+	if _, err := redoLast(actingStaff(), replayAllowed); err != nil && !errors.Is(err, errNothingToRedo) {
+		dialog.ShowError(err, mainWindow)
+	}
+	refreshUndoButtons()
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+// TestUndoWaitsForLogWrites undoes check-ins while their log writes may still
+// be in flight; each undo must remove its entry, not race the write.
+func TestUndoWaitsForLogWrites(t *testing.T) {
+	setupTestLounge(t)
+
+	for i := 0; i < 20; i++ {
+		id := fmt.Sprintf("u%d", i)
+		if err := registerUser("User "+id, id, 1+i%16, "", "test"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := undoLast("test", nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	flushLogWrites()
+	entries, err := readDailyLogEntries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("undone check-ins left %d log entries", len(entries))
+	}
+	if users := snapshotState().Users; len(users) != 0 {
+		t.Errorf("undone check-ins left %d users", len(users))
+	}
+}
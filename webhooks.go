@@ -0,0 +1,316 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// ---------- Outgoing webhooks ----------
+//
+// Every published event a webhook subscribes to is appended to
+// log/webhook_queue.json, so a process that exits straight away (a CLI
+// command) or a receiver that is down loses nothing. The primary window, or
+// "serve", posts the queue to each endpoint in order, retrying with backoff.
+
+const (
+	webhookQueueFile = "log/webhook_queue.json"
+
+	webhookTimeout    = 10 * time.Second
+	webhookPoll       = 2 * time.Second
+	webhookMinBackoff = 5 * time.Second
+	webhookMaxBackoff = time.Hour
+	// webhookMaxAge drops deliveries nobody has accepted for this long.
+	webhookMaxAge = 72 * time.Hour
+)
+
+// webhookDefaultEvents are sent when a webhook lists no events.
+var webhookDefaultEvents = []string{EventCheckIn, EventCheckOut, EventQueueJoin, EventDeviceFreed}
+
+type WebhookConfig struct {
+	URL string `json:"url"`
+	// Secret signs each body; the signature is sent as
+	// X-Lounge-Signature: sha256=<hex HMAC>.
+	Secret string   `json:"secret"`
+	Events []string `json:"events,omitempty"`
+}
+
+func (h WebhookConfig) wants(eventType string) bool {
+	events := h.Events
+	if len(events) == 0 {
+		events = webhookDefaultEvents
+	}
+	return containsString(events, eventType)
+}
+
+// webhookDelivery is one event waiting for one endpoint. The secret is looked
+// up from the config when sending so it is never written to the queue file.
+type webhookDelivery struct {
+	ID          string      `json:"id"`
+	URL         string      `json:"url"`
+	Event       LoungeEvent `json:"event"`
+	Created     time.Time   `json:"created"`
+	Attempts    int         `json:"attempts"`
+	NextAttempt time.Time   `json:"next_attempt"`
+	LastError   string      `json:"last_error,omitempty"`
+}
+
+type webhookPayload struct {
+	ID    string      `json:"id"`
+	Event LoungeEvent `json:"event"`
+}
+
+var (
+	webhookMu      sync.Mutex
+	webhookPending []webhookDelivery
+	webhookSignal  = make(chan struct{}, 1)
+	webhookWriter  sync.Once
+	webhookSender  sync.Once
+	// pendingWebhookWrites lets headless callers wait until queued events
+	// are on disk before exiting.
+	pendingWebhookWrites sync.WaitGroup
+)
+
+// queueWebhooks hands ev to every webhook that wants it. It never blocks on
+// the disk; a background writer appends to the queue file.
+func queueWebhooks(ev LoungeEvent) {
+	var add []webhookDelivery
+	for _, h := range appConfig.Webhooks {
+		if h.URL == "" || !h.wants(ev.Type) {
+			continue
+		}
+		add = append(add, webhookDelivery{ID: newDeliveryID(), URL: h.URL, Event: ev, Created: ev.Time, NextAttempt: ev.Time})
+	}
+	if len(add) == 0 {
+		return
+	}
+	webhookWriter.Do(func() { go writeWebhookQueue() })
+	pendingWebhookWrites.Add(len(add))
+	webhookMu.Lock()
+	webhookPending = append(webhookPending, add...)
+	webhookMu.Unlock()
+	select {
+	case webhookSignal <- struct{}{}:
+	default:
+	}
+}
+
+func newDeliveryID() string {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%d", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
+// writeWebhookQueue appends queued deliveries to the file in batches.
+func writeWebhookQueue() {
+	for range webhookSignal {
+		webhookMu.Lock()
+		batch := webhookPending
+		webhookPending = nil
+		webhookMu.Unlock()
+		if len(batch) == 0 {
+			continue
+		}
+		err := withDataLock(func() error {
+			q, err := readWebhookQueue()
+			if err != nil {
+				return err
+			}
+			return writeWebhookQueueFile(append(q, batch...))
+		})
+		if err != nil {
+			fmt.Println("Error queueing webhooks:", err)
+		}
+		for range batch {
+			pendingWebhookWrites.Done()
+		}
+	}
+}
+
+// readWebhookQueue loads the queue. Call under withDataLock.
+func readWebhookQueue() ([]webhookDelivery, error) {
+	b, err := os.ReadFile(webhookQueueFile)
+	if os.IsNotExist(err) || (err == nil && len(b) == 0) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var q []webhookDelivery
+	if err := json.Unmarshal(b, &q); err != nil {
+		return nil, fmt.Errorf("unmarshal %s: %w", webhookQueueFile, err)
+	}
+	return q, nil
+}
+
+func writeWebhookQueueFile(q []webhookDelivery) error {
+	data, err := json.MarshalIndent(q, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal webhook queue: %w", err)
+	}
+	tmp := webhookQueueFile + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, webhookQueueFile)
+}
+
+// ---------- Webhook sender ----------
+
+// startWebhookSender delivers the queue in the background; later calls do
+// nothing. Run it only holding the instance lock, so one process per data
+// folder delivers.
+func startWebhookSender() {
+	if len(appConfig.Webhooks) == 0 {
+		return
+	}
+	webhookSender.Do(func() {
+		client := &http.Client{Timeout: webhookTimeout}
+		go func() {
+			for range time.Tick(webhookPoll) {
+				sendDueWebhooks(client, time.Now())
+			}
+		}()
+	})
+}
+
+// sendDueWebhooks posts each endpoint's queue in order, starting once its
+// oldest delivery is due and going on while deliveries succeed. Later events
+// for an endpoint wait behind a failing one so the receiver sees them in
+// order.
+func sendDueWebhooks(client *http.Client, now time.Time) {
+	var urls []string
+	byURL := map[string][]webhookDelivery{}
+	err := withDataLock(func() error {
+		q, err := readWebhookQueue()
+		if err != nil {
+			return err
+		}
+		for _, d := range q {
+			if _, ok := byURL[d.URL]; !ok {
+				urls = append(urls, d.URL)
+			}
+			byURL[d.URL] = append(byURL[d.URL], d)
+		}
+		return nil
+	})
+	if err != nil {
+		fmt.Println("Error reading webhook queue:", err)
+		return
+	}
+
+	results := map[string]error{}
+	for _, url := range urls {
+		for _, d := range byURL[url] {
+			if d.NextAttempt.After(now) {
+				break
+			}
+			err := postWebhook(client, d)
+			results[d.ID] = err
+			if err != nil {
+				break
+			}
+		}
+	}
+	if len(results) == 0 {
+		return
+	}
+
+	err = withDataLock(func() error {
+		q, err := readWebhookQueue()
+		if err != nil {
+			return err
+		}
+		kept := q[:0]
+		for _, d := range q {
+			sendErr, tried := results[d.ID]
+			switch {
+			case !tried:
+			case sendErr == nil:
+				continue
+			case now.Sub(d.Created) > webhookMaxAge:
+				fmt.Printf("Dropping webhook %s for %s after %d attempts: %v\n", d.ID, d.URL, d.Attempts+1, sendErr)
+				continue
+			default:
+				d.Attempts++
+				d.LastError = sendErr.Error()
+				d.NextAttempt = now.Add(webhookBackoff(d.Attempts))
+			}
+			kept = append(kept, d)
+		}
+		return writeWebhookQueueFile(kept)
+	})
+	if err != nil {
+		fmt.Println("Error updating webhook queue:", err)
+	}
+}
+
+func webhookBackoff(attempts int) time.Duration {
+	d := webhookMinBackoff
+	for i := 1; i < attempts && d < webhookMaxBackoff; i++ {
+		d *= 2
+	}
+	if d > webhookMaxBackoff {
+		d = webhookMaxBackoff
+	}
+	return d
+}
+
+func webhookSecret(url string) (string, bool) {
+	for _, h := range appConfig.Webhooks {
+		if h.URL == url {
+			return h.Secret, true
+		}
+	}
+	return "", false
+}
+
+func signWebhook(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// postWebhook sends one delivery; any 2xx answer counts as delivered. A
+// webhook removed from the config is treated as delivered so it is dropped.
+func postWebhook(client *http.Client, d webhookDelivery) error {
+	secret, ok := webhookSecret(d.URL)
+	if !ok {
+		return nil
+	}
+	body, err := json.Marshal(webhookPayload{ID: d.ID, Event: d.Event})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, d.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Lounge-Event", d.Event.Type)
+	req.Header.Set("X-Lounge-Delivery", d.ID)
+	if secret != "" {
+		req.Header.Set("X-Lounge-Signature", signWebhook(secret, body))
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s answered %s", d.URL, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// roundTripFunc answers webhook posts without a network.
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+// TestWebhooksDrainUntilFailure checks that one pass sends an endpoint's
+// backlog in order and stops at the first failure.
+func TestWebhooksDrainUntilFailure(t *testing.T) {
+	setupTestLounge(t)
+	saved := appConfig.Webhooks
+	t.Cleanup(func() { appConfig.Webhooks = saved })
+	const url = "http://desk.example/hook"
+	appConfig.Webhooks = []WebhookConfig{{URL: url}}
+
+	now := time.Now()
+	var q []webhookDelivery
+	for _, id := range []string{"d1", "d2", "d3", "d4", "d5"} {
+		q = append(q, webhookDelivery{ID: id, URL: url, Event: LoungeEvent{Type: EventCheckIn}, Created: now, NextAttempt: now})
+	}
+	if err := withDataLock(func() error { return writeWebhookQueueFile(q) }); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	client := &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		id := r.Header.Get("X-Lounge-Delivery")
+		got = append(got, id)
+		if id == "d4" {
+			return nil, errors.New("receiver down")
+		}
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader("")), Request: r}, nil
+	})}
+	sendDueWebhooks(client, now)
+
+	if strings.Join(got, ",") != "d1,d2,d3,d4" {
+		t.Fatalf("sent %v, want d1 to d4 in order", got)
+	}
+	var left []webhookDelivery
+	if err := withDataLock(func() error {
+		var err error
+		left, err = readWebhookQueue()
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(left) != 2 || left[0].ID != "d4" || left[0].Attempts != 1 || left[1].Attempts != 0 {
+		t.Fatalf("queue left %+v, want d4 (one attempt) then d5", left)
+	}
+}